@@ -1,7 +1,29 @@
 package address
 
-// AddressHandler defines the interface for address validation and conversion.
+import "fmt"
+
+// AddressHandler defines the interface for address validation and conversion. Stores hold any kind
+// of element an AddressHandler converts to bytes, such as transaction hashes or domain names.
 type AddressHandler interface {
 	Validate(address string) error          // Validate the format of the address.
 	ToBytes(address string) ([]byte, error) // Convert the address to a byte slice.
+	Type() string                           // Name of the address type, recorded in filter files.
+}
+
+// NewAddressHandler returns the AddressHandler for an address type name, as returned by its Type method.
+func NewAddressHandler(addressType string) (AddressHandler, error) {
+	switch addressType {
+	case "evm":
+		return &EVMAddressHandler{}, nil
+	case "bitcoin":
+		return &BitcoinAddressHandler{}, nil
+	case "tx-hash":
+		return &TxHashHandler{}, nil
+	case "code-hash":
+		return &CodeHashHandler{}, nil
+	case "domain":
+		return &DomainHandler{}, nil
+	default:
+		return nil, fmt.Errorf("unknown address type: %q", addressType)
+	}
 }
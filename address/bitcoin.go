@@ -22,3 +22,8 @@ func (h *BitcoinAddressHandler) ToBytes(address string) ([]byte, error) {
 	}
 	return addr.ScriptAddress(), nil
 }
+
+// Type returns "bitcoin".
+func (h *BitcoinAddressHandler) Type() string {
+	return "bitcoin"
+}
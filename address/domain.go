@@ -0,0 +1,56 @@
+package address
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DomainHandler handles domain names. Names are normalized before they are converted to bytes:
+// surrounding spaces and a trailing dot are removed and letters are lowercased, so that
+// "Example.COM." and "example.com" are the same element. Internationalized names must be given in
+// their ASCII form, e.g. "xn--bcher-kva.example".
+type DomainHandler struct{}
+
+// Validate checks if the string is a valid domain name: at most 253 characters, in dot-separated
+// labels of 1 to 63 letters, digits and hyphens that do not start or end with a hyphen.
+func (h *DomainHandler) Validate(domain string) error {
+	_, err := normalizeDomain(domain)
+	return err
+}
+
+// ToBytes converts the normalized domain name to bytes.
+func (h *DomainHandler) ToBytes(domain string) ([]byte, error) {
+	normalized, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(normalized), nil
+}
+
+// Type returns "domain".
+func (h *DomainHandler) Type() string {
+	return "domain"
+}
+
+// normalizeDomain validates and normalizes a domain name, see DomainHandler.
+func normalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if domain == "" || len(domain) > 253 {
+		return "", errors.New("invalid domain name length")
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return "", fmt.Errorf("invalid domain label %q", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("domain label %q starts or ends with a hyphen", label)
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", fmt.Errorf("invalid character %q in domain name, internationalized names must be in ASCII form", c)
+			}
+		}
+	}
+	return domain, nil
+}
@@ -0,0 +1,40 @@
+package address
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDomainHandler_ToBytes(t *testing.T) {
+	handler := &DomainHandler{}
+
+	tests := []struct {
+		name   string
+		domain string
+		want   string
+		err    bool
+	}{
+		{"lower case", "example.com", "example.com", false},
+		{"normalized", " Wallet-Connect.EXAMPLE.com. ", "wallet-connect.example.com", false},
+		{"punycode", "xn--bcher-kva.example", "xn--bcher-kva.example", false},
+		{"unicode", "bücher.example", "", true},
+		{"empty label", "example..com", "", true},
+		{"leading hyphen", "-example.com", "", true},
+		{"long label", strings.Repeat("a", 64) + ".com", "", true},
+		{"underscore", "my_site.com", "", true},
+		{"empty", " ", "", true},
+	}
+
+	for _, test := range tests {
+		result, err := handler.ToBytes(test.domain)
+		if (err != nil) != test.err {
+			t.Errorf("ToBytes(%q) = %v; want error = %v", test.domain, err, test.err)
+		}
+		if !test.err && string(result) != test.want {
+			t.Errorf("ToBytes(%q) = %q; want %q", test.domain, result, test.want)
+		}
+		if (handler.Validate(test.domain) != nil) != test.err {
+			t.Errorf("Validate(%q) disagrees with ToBytes", test.domain)
+		}
+	}
+}
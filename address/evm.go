@@ -24,6 +24,11 @@ func (h *EVMAddressHandler) ToBytes(address string) ([]byte, error) {
 	return hex.DecodeString(address[2:])
 }
 
+// Type returns "evm".
+func (h *EVMAddressHandler) Type() string {
+	return "evm"
+}
+
 // has0xPrefix validates str begins with '0x' or '0X'.
 func has0xPrefix(str string) bool {
 	return len(str) == 42 && str[0] == '0' && (str[1] == 'x' || str[1] == 'X')
@@ -0,0 +1,69 @@
+package address
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// TxHashHandler handles 32-byte transaction hashes, given as 64 hex characters with or without a
+// 0x prefix.
+type TxHashHandler struct{}
+
+// Validate checks if the string is a valid 32-byte hash.
+func (h *TxHashHandler) Validate(hash string) error {
+	return validateHash32(hash)
+}
+
+// ToBytes converts the hash to its 32 bytes.
+func (h *TxHashHandler) ToBytes(hash string) ([]byte, error) {
+	return hash32ToBytes(hash)
+}
+
+// Type returns "tx-hash".
+func (h *TxHashHandler) Type() string {
+	return "tx-hash"
+}
+
+// CodeHashHandler handles 32-byte contract bytecode hashes, such as the keccak256 code hash of an
+// account, in the format of TxHashHandler. Its Type differs, so that both sets are not mixed up.
+type CodeHashHandler struct{}
+
+// Validate checks if the string is a valid 32-byte hash.
+func (h *CodeHashHandler) Validate(hash string) error {
+	return validateHash32(hash)
+}
+
+// ToBytes converts the hash to its 32 bytes.
+func (h *CodeHashHandler) ToBytes(hash string) ([]byte, error) {
+	return hash32ToBytes(hash)
+}
+
+// Type returns "code-hash".
+func (h *CodeHashHandler) Type() string {
+	return "code-hash"
+}
+
+// trimHexPrefix removes a 0x or 0X prefix.
+func trimHexPrefix(s string) string {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:]
+	}
+	return s
+}
+
+// validateHash32 checks the length of a hex encoded 32-byte hash, the hex decoding catches invalid
+// characters.
+func validateHash32(hash string) error {
+	if len(trimHexPrefix(hash)) != 64 {
+		return errors.New("invalid hash format, expected 32 bytes in hex")
+	}
+	return nil
+}
+
+// hash32ToBytes decodes a hex encoded 32-byte hash.
+func hash32ToBytes(hash string) ([]byte, error) {
+	if err := validateHash32(hash); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(trimHexPrefix(hash))
+}
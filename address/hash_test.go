@@ -0,0 +1,38 @@
+package address
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashHandlers_ToBytes(t *testing.T) {
+	hash := "0x" + strings.Repeat("ab", 32)
+	want := make([]byte, 32)
+	for i := range want {
+		want[i] = 0xab
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		err  bool
+	}{
+		{"prefixed", hash, false},
+		{"upper case", strings.ToUpper(hash), false},
+		{"no prefix", hash[2:], false},
+		{"too short", hash[:65], true},
+		{"invalid hex", "0x" + strings.Repeat("zz", 32), true},
+	}
+
+	for _, handler := range []AddressHandler{&TxHashHandler{}, &CodeHashHandler{}} {
+		for _, test := range tests {
+			result, err := handler.ToBytes(test.hash)
+			if (err != nil) != test.err {
+				t.Errorf("%s ToBytes(%q) = %v; want error = %v", handler.Type(), test.hash, err, test.err)
+			}
+			if !test.err && !equalBytes(result, want) {
+				t.Errorf("%s ToBytes(%q) = %x; want %x", handler.Type(), test.hash, result, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"addressdb/store"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// filterOption returns the store option creating an empty filter of the named backend, sized for
+// n elements at false positive rate p where the backend supports it. Bloom filters are sized to fit
+// in maxSize instead if it is set. Generational filters match elements for ttl, with n elements in
+// each of their generations.
+func filterOption(backend string, n uint, p float64, maxSize string, ttl time.Duration, generations uint) (store.Option, error) {
+	if maxSize != "" && backend != store.BloomFilterType {
+		return nil, fmt.Errorf("--max-size is only supported by the %q backend", store.BloomFilterType)
+	}
+
+	switch backend {
+	case store.BloomFilterType:
+		if maxSize != "" {
+			size, err := parseSize(maxSize)
+			if err != nil {
+				return nil, err
+			}
+			plan, err := store.PlanForSize(n, size)
+			if err != nil {
+				return nil, err
+			}
+			return store.WithPlan(plan), nil
+		}
+		return store.WithEstimates(n, p), nil
+	case store.CuckooFilterType:
+		return store.WithFilter(store.NewCuckooFilter(n)), nil
+	case store.ScalableBloomFilterType:
+		return store.WithScalableEstimates(n, p), nil
+	case store.GenerationalBloomFilterType:
+		if ttl <= 0 {
+			return nil, errors.New("the generational backend needs a positive --ttl")
+		}
+		return store.WithTTL(ttl, generations, n, p), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q, expected one of %q, %q, %q, %q or %q", backend, store.BloomFilterType,
+			store.ScalableBloomFilterType, store.GenerationalBloomFilterType, store.CuckooFilterType, store.XorFilterType)
+	}
+}
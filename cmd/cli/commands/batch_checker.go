@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"addressdb/address"
 	"addressdb/store"
 	"bufio"
 	"fmt"
@@ -18,18 +17,31 @@ var BatchCheckCmd = &cobra.Command{
 	Run:   runBatchCheck,
 }
 
-var batchFilename string
+var (
+	batchFilename string
+	batchSecure   secureFlags
+)
 
 func init() {
 	BatchCheckCmd.Flags().StringVarP(&batchFilename, "file", "f", "bloomfilter.gob", "Path to the .gob file containing the Bloom filter")
+	batchSecure.register(BatchCheckCmd)
 }
 
 func runBatchCheck(_ *cobra.Command, _ []string) {
 	start := time.Now()
 
 	// Open the serialized Bloom filter file
-	addressHandler := &address.EVMAddressHandler{}
-	filter, err := store.NewBloomFilterStoreFromFile(batchFilename, addressHandler)
+	addressHandler, err := store.ReadAddressHandler(batchFilename)
+	if err != nil {
+		fmt.Println("Error reading header:", err)
+		os.Exit(-1)
+	}
+	opts, err := batchSecure.options()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	filter, err := store.NewBloomFilterStoreFromFile(batchFilename, addressHandler, opts...)
 	if err != nil {
 		fmt.Println("Error opening file:", err)
 		os.Exit(-1)
@@ -44,23 +56,26 @@ func runBatchCheck(_ *cobra.Command, _ []string) {
 	// Measure the time it takes to check the bloom filter
 	start = time.Now()
 
-	// Read from standard input, till EOF, and check if the string is in the bloom filter
-	for {
-		if !scanner.Scan() {
-			if scanner.Err() != nil {
-				// Print to stderr
-				fmt.Fprintf(os.Stderr, "Error reading from standard input: %v\n", scanner.Err())
+	// Read from standard input, till EOF, and check the addresses in batches
+	batch := make([]string, 0, batchSize)
+	check := func() {
+		for i, result := range filter.CheckAddresses(batch) {
+			// Only handle non-existing entries
+			if result.Err != nil {
+				fmt.Println("Error checking address:", result.Err)
+			} else if !result.Found() {
+				fmt.Println("NOT in set:", batch[i])
 			}
-			break
 		}
-		input := scanner.Text()
-		// Only handle non-existing entries
-		if ok, err := filter.CheckAddress(input); err != nil {
-			fmt.Println("Error checking address:", err)
-		} else if !ok {
-			fmt.Println("NOT in set:", input)
+		batch = batch[:0]
+	}
+	for scanner.Scan() {
+		batch = append(batch, scanner.Text())
+		if len(batch) == batchSize {
+			check()
 		}
 	}
+	check()
 	elapsed = time.Since(start)
 	fmt.Printf("> Time taken to check bloomfilter: %v\n", elapsed)
 
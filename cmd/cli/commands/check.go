@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"addressdb/address"
 	"addressdb/store"
 	"bufio"
 	"fmt"
@@ -17,15 +16,28 @@ var CheckCmd = &cobra.Command{
 	Run:   runCheck,
 }
 
-var filename string
+var (
+	filename    string
+	checkSecure secureFlags
+)
 
 func init() {
 	CheckCmd.Flags().StringVarP(&filename, "file", "f", "bloomfilter.gob", "Path to the .gob file containing the Bloom filter")
+	checkSecure.register(CheckCmd)
 }
 
 func runCheck(_ *cobra.Command, _ []string) {
-	addressHandler := &address.EVMAddressHandler{}
-	filter, err := store.NewBloomFilterStoreFromFile(filename, addressHandler)
+	addressHandler, err := store.ReadAddressHandler(filename)
+	if err != nil {
+		fmt.Println("Error reading header:", err)
+		os.Exit(-1)
+	}
+	opts, err := checkSecure.options()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	filter, err := store.NewBloomFilterStoreFromFile(filename, addressHandler, opts...)
 	if err != nil {
 		fmt.Println("Error opening file:", err)
 		os.Exit(-1)
@@ -45,9 +57,11 @@ func runCheck(_ *cobra.Command, _ []string) {
 			break
 		}
 		input := scanner.Text()
-		if ok, err := filter.CheckAddress(input); err != nil {
+		if match, err := filter.MatchAddress(input); err != nil {
 			fmt.Println("Error checking address: ", err)
-		} else if ok {
+		} else if match == store.Present {
+			fmt.Println("Definitely in set.")
+		} else if match == store.PossiblyPresent {
 			fmt.Println("Possibly in set.")
 		} else {
 			fmt.Println("Definitely not in set.")
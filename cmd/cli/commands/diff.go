@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"addressdb/store"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Write the bits set in a Bloom filter since an older version as a delta",
+	Run:   runDiff,
+}
+
+var (
+	diffFrom       string
+	diffTo         string
+	diffOutputFile string
+	diffSecure     secureFlags
+	diffInSecure   secureFlags
+)
+
+func init() {
+	DiffCmd.Flags().StringVar(&diffFrom, "from", "", "path to the base version of the filter")
+	DiffCmd.Flags().StringVar(&diffTo, "to", "", "path to the new version of the filter")
+	DiffCmd.Flags().StringVarP(&diffOutputFile, "output", "o", "", "output file for the delta (default <from>.delta)")
+	DiffCmd.MarkFlagRequired("from")
+	DiffCmd.MarkFlagRequired("to")
+	diffSecure.register(DiffCmd)
+	diffInSecure.registerWithPrefix(DiffCmd, "in-", "input files, if they use other keys than the delta: ")
+}
+
+func runDiff(_ *cobra.Command, _ []string) {
+	handler, err := diffSecure.handler()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	opts, err := inputOptions(&diffInSecure, &diffSecure)
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+
+	var filters []*store.BloomFilterStore
+	for _, filePath := range []string{diffFrom, diffTo} {
+		addressHandler, err := store.ReadAddressHandler(filePath)
+		if err != nil {
+			fmt.Println("Error reading header:", err)
+			os.Exit(-1)
+		}
+		filter, err := store.NewBloomFilterStoreFromFile(filePath, addressHandler, opts...)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			os.Exit(-1)
+		}
+		filters = append(filters, filter)
+	}
+
+	if diffOutputFile == "" {
+		diffOutputFile = store.DeltaPath(diffFrom)
+	}
+	if err := store.WriteDeltaFile(diffOutputFile, filters[0], filters[1], handler); err != nil {
+		fmt.Println("Error writing delta:", err)
+		os.Exit(-1)
+	}
+	fmt.Println("Delta has been written successfully.")
+}
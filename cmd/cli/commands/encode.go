@@ -4,8 +4,13 @@ import (
 	"addressdb/address"
 	"addressdb/store"
 	"bufio"
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -17,24 +22,49 @@ var EncodeCmd = &cobra.Command{
 }
 
 var (
-	nFlag      uint
-	pFlag      float64
-	inputFile  string
-	outputFile string
+	nFlag       uint
+	pFlag       float64
+	inputFile   string
+	outputFile  string
+	backend     string
+	source      string
+	commit      bool
+	exact       bool
+	csvInput    bool
+	ttl         time.Duration
+	generations uint
+	elementType string
+	autoSize    bool
+	maxSize     string
+
+	encodeSecure secureFlags
 )
 
+// batchSize is the number of addresses read before they are added to or checked against a filter.
+const batchSize = 1 << 16
+
 func init() {
 	EncodeCmd.Flags().UintVarP(&nFlag, "number", "n", 10000000, "number of elements expected")
 	EncodeCmd.Flags().Float64VarP(&pFlag, "probability", "p", 0.00001, "false positive probability")
 	EncodeCmd.Flags().StringVarP(&inputFile, "input", "i", "addresses.txt", "input file path")
 	EncodeCmd.Flags().StringVarP(&outputFile, "output", "o", "bloomfilter.gob", "output file path")
+	EncodeCmd.Flags().StringVarP(&backend, "backend", "b", store.BloomFilterType, "filter backend: bloom, scalable-bloom, generational-bloom, cuckoo or xor")
+	EncodeCmd.Flags().DurationVar(&ttl, "ttl", 0, "how long addresses are matched after being added, for the generational-bloom backend")
+	EncodeCmd.Flags().UintVar(&generations, "generations", 30, "number of generations the TTL is split into, each holding -n addresses, for the generational-bloom backend")
+	EncodeCmd.Flags().StringVarP(&elementType, "type", "t", "evm", "type of the elements: evm, bitcoin, tx-hash, code-hash or domain")
+	EncodeCmd.Flags().StringVarP(&source, "source", "s", "", "source label recorded in the file header")
+	EncodeCmd.Flags().BoolVar(&commit, "commit", false, "commit to the addresses with a Merkle tree, written next to the output as <output>.merkle")
+	EncodeCmd.Flags().BoolVar(&autoSize, "auto-size", false, "count the distinct valid addresses of the input first and use the count as -n")
+	EncodeCmd.Flags().StringVar(&maxSize, "max-size", "", "size the bloom backend to fit the file in this many bytes, with an optional K, M or G suffix, instead of using -p")
+	EncodeCmd.Flags().BoolVar(&exact, "exact", false, "store the addresses in an exact tier confirming filter matches")
+	EncodeCmd.Flags().BoolVar(&csvInput, "csv", false, "read a CSV with columns address,category,source,first_seen and write the address info next to the output as <output>.info")
+	encodeSecure.register(EncodeCmd)
 }
 
 func runEncode(_ *cobra.Command, _ []string) {
-	addressHandler := &address.EVMAddressHandler{}
-	filter, err := store.NewBloomFilterStore(addressHandler, store.WithEstimates(nFlag, pFlag))
+	addressHandler, err := address.NewAddressHandler(elementType)
 	if err != nil {
-		fmt.Println("Error creating Bloom filter:", err)
+		fmt.Println("Error:", err)
 		os.Exit(-1)
 	}
 
@@ -45,12 +75,43 @@ func runEncode(_ *cobra.Command, _ []string) {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		filter.AddAddress(scanner.Text())
+	if autoSize && backend != store.XorFilterType {
+		count, err := countDistinct(file, addressHandler)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			fmt.Println("Error counting addresses:", err)
+			os.Exit(-1)
+		}
+		nFlag = max(count, 1)
+		fmt.Printf("Sizing the filter for %d distinct addresses.\n", count)
+	}
+
+	opts, err := encodeSecure.options()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	opts = append(opts, store.WithSource(source))
+	if commit {
+		opts = append(opts, store.WithCommitment())
+	}
+	if exact {
+		opts = append(opts, store.WithExactMatch())
+	}
+	if csvInput {
+		opts = append(opts, store.WithAddressInfo())
+	}
+
+	var filter *store.BloomFilterStore
+	if backend == store.XorFilterType {
+		filter, err = encodeXor(file, addressHandler, opts)
+	} else {
+		filter, err = encodeIncremental(file, addressHandler, opts)
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Println("Error reading from file:", err)
+	if err != nil {
+		fmt.Println("Error encoding addresses:", err)
 		os.Exit(-1)
 	}
 
@@ -60,3 +121,156 @@ func runEncode(_ *cobra.Command, _ []string) {
 	}
 	fmt.Println("Bloom filter has been serialized successfully.")
 }
+
+// encodeIncremental adds addresses in batches to a filter that supports insertion.
+func encodeIncremental(r io.Reader, addressHandler address.AddressHandler, opts []store.Option) (*store.BloomFilterStore, error) {
+	filterOpt, err := filterOption(backend, nFlag, pFlag, maxSize, ttl, generations)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := store.NewBloomFilterStore(addressHandler, append(opts, filterOpt)...)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, batchSize)
+	infos := make([]*store.AddressInfo, 0, batchSize)
+	flush := func() error {
+		errs := filter.AddAddresses(addresses)
+		for i, address := range addresses {
+			if errs != nil && errors.Is(errs[i], store.ErrFilterFull) {
+				return errs[i]
+			} else if (errs == nil || errs[i] == nil) && infos[i] != nil {
+				if err := filter.AddAddressInfo(address, *infos[i]); err != nil {
+					return err
+				}
+			}
+		}
+		addresses, infos = addresses[:0], infos[:0]
+		return nil
+	}
+
+	err = readRecords(r, func(address string, info *store.AddressInfo) error {
+		addresses = append(addresses, address)
+		infos = append(infos, info)
+		if len(addresses) == batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// countDistinct returns the number of distinct valid addresses in the input.
+func countDistinct(r io.Reader, addressHandler address.AddressHandler) (uint, error) {
+	seen := make(map[string]struct{})
+	err := readRecords(r, func(address string, _ *store.AddressInfo) error {
+		if addressHandler.Validate(address) != nil {
+			return nil
+		}
+		if addressBytes, err := addressHandler.ToBytes(address); err == nil {
+			seen[string(addressBytes)] = struct{}{}
+		}
+		return nil
+	})
+	return uint(len(seen)), err
+}
+
+// encodeXor reads every valid address and builds an immutable xor filter from the complete set.
+func encodeXor(r io.Reader, addressHandler address.AddressHandler, opts []store.Option) (*store.BloomFilterStore, error) {
+	var addresses []string
+	infos := make(map[string][]store.AddressInfo)
+	err := readRecords(r, func(address string, info *store.AddressInfo) error {
+		if addressHandler.Validate(address) == nil {
+			addresses = append(addresses, address)
+			if info != nil {
+				infos[address] = append(infos[address], *info)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := store.NewXorFilterStore(addresses, addressHandler, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for address, entries := range infos {
+		for _, info := range entries {
+			if err := filter.AddAddressInfo(address, info); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return filter, nil
+}
+
+// readRecords calls add for every line of the input, or every row if it is a CSV. Info is nil for
+// plain inputs.
+func readRecords(r io.Reader, add func(address string, info *store.AddressInfo) error) error {
+	if !csvInput {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if err := add(scanner.Text(), nil); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		return nil
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue // header
+		}
+
+		info, err := parseAddressInfo(record)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := add(strings.TrimSpace(record[0]), info); err != nil {
+			return err
+		}
+	}
+}
+
+// parseAddressInfo parses the category, source and first_seen columns of a CSV record. first_seen
+// is either RFC 3339 or a date.
+func parseAddressInfo(record []string) (*store.AddressInfo, error) {
+	field := func(i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	info := &store.AddressInfo{Category: field(1), Source: field(2)}
+	if firstSeen := field(3); firstSeen != "" {
+		t, err := time.Parse(time.RFC3339, firstSeen)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, firstSeen); err != nil {
+				return nil, fmt.Errorf("invalid first_seen %q", firstSeen)
+			}
+		}
+		info.FirstSeen = t.UTC()
+	}
+	return info, nil
+}
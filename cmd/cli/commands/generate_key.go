@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"addressdb/oprf"
+	"addressdb/securedata"
+	"addressdb/store"
+	"crypto/rand"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var KeyGenCmd = &cobra.Command{
+	Use:   "generate-key",
+	Short: "Generate a key for hashing addresses before they are added to a filter",
+	Run:   runKeyGenerator,
+}
+
+var (
+	keyOutputFile string
+	keyOPRF       bool
+	keySecure     secureFlags
+)
+
+func init() {
+	KeyGenCmd.Flags().StringVarP(&keyOutputFile, "output", "o", "hashkey.bin", "output file for the key")
+	KeyGenCmd.Flags().BoolVar(&keyOPRF, "oprf", false, "generate an OPRF key, for filters queried through a server with --oprf-server")
+	keySecure.register(KeyGenCmd)
+}
+
+func runKeyGenerator(_ *cobra.Command, _ []string) {
+	key, keyID, err := generateKey()
+	if err != nil {
+		fmt.Println("Error generating key:", err)
+		os.Exit(-1)
+	}
+
+	handler, err := keySecure.handler()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+
+	file, err := os.OpenFile(keyOutputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		os.Exit(-1)
+	}
+	defer file.Close()
+
+	if handler != nil {
+		err = securedata.WriteSecret(handler, file, key)
+	} else {
+		_, err = file.Write(key)
+	}
+	if err != nil {
+		fmt.Println("Error writing key:", err)
+		os.Exit(-1)
+	}
+	fmt.Println("Key id:", keyID)
+}
+
+// generateKey generates a HMAC or OPRF key and returns it with its key id.
+func generateKey() ([]byte, string, error) {
+	if keyOPRF {
+		key, err := oprf.GenerateKey()
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := key.MarshalBinary()
+		return data, key.KeyID(), err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", err
+	}
+	return key, store.HashKeyID(key), nil
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"addressdb/store"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var InspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Print the header and fill statistics of a filter file",
+	Run:   runInspect,
+}
+
+var (
+	inspectFilename string
+	inspectJSON     bool
+	inspectSecure   secureFlags
+)
+
+func init() {
+	InspectCmd.Flags().StringVarP(&inspectFilename, "file", "f", "bloomfilter.gob", "Path to the .gob file containing the Bloom filter")
+	InspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "print the result as JSON")
+	inspectSecure.register(InspectCmd)
+}
+
+func runInspect(_ *cobra.Command, _ []string) {
+	addressHandler, err := store.ReadAddressHandler(inspectFilename)
+	if err != nil {
+		fmt.Println("Error reading header:", err)
+		os.Exit(-1)
+	}
+
+	opts, err := inspectSecure.options()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	filter, err := store.NewBloomFilterStoreFromFile(inspectFilename, addressHandler, opts...)
+	if err != nil {
+		fmt.Println("Error opening file:", err)
+		os.Exit(-1)
+	}
+
+	result := struct {
+		Metadata store.Metadata    `json:"metadata"`
+		Stats    store.FilterStats `json:"stats"`
+	}{
+		Metadata: filter.Metadata(),
+		Stats:    filter.Stats(),
+	}
+
+	if inspectJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Println("Error encoding JSON:", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	m, s := result.Metadata, result.Stats
+	fmt.Printf("Format version:         %d\n", m.Version)
+	fmt.Printf("Filter type:            %s\n", m.FilterType)
+	fmt.Printf("Address type:           %s\n", m.AddressType)
+	fmt.Printf("Source:                 %s\n", m.Source)
+	fmt.Printf("Build time:             %s\n", m.BuildTime)
+	fmt.Printf("Encrypted:              %t\n", m.Encrypted)
+	fmt.Printf("Hash key id:            %s\n", m.KeyID)
+	fmt.Printf("Merkle root:            %s\n", m.MerkleRoot)
+	fmt.Printf("Exact tier:             %t\n", m.Exact)
+	fmt.Printf("Checksum:               %s\n", m.Checksum)
+	fmt.Printf("Target capacity:        %d\n", m.Capacity)
+	fmt.Printf("Target FPR:             %g\n", m.FalsePositiveRate)
+	fmt.Printf("Addresses added:        %d\n", m.ElementCount)
+	fmt.Printf("Size (m):               %d\n", s.Capacity)
+	fmt.Printf("Hash functions (k):     %d\n", s.HashFunctions)
+	fmt.Printf("Bits set:               %d\n", s.BitsSet)
+	fmt.Printf("Fill ratio:             %.4f\n", s.FillRatio)
+	fmt.Printf("Approximate count:      %d\n", s.ApproximateCount)
+	fmt.Printf("Estimated current FPR:  %g\n", s.EstimatedFalsePositiveRate)
+	if s.Slices > 0 {
+		fmt.Printf("Slices:                 %d\n", s.Slices)
+	}
+}
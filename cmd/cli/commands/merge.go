@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"addressdb/store"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var MergeCmd = &cobra.Command{
+	Use:   "merge <input>...",
+	Short: "Combine Bloom filters built with the same parameters into one",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   runMerge,
+}
+
+var (
+	mergeOutputFile string
+	mergeIntersect  bool
+	mergeSource     string
+	mergeSecure     secureFlags
+	mergeInSecure   secureFlags
+)
+
+func init() {
+	MergeCmd.Flags().StringVarP(&mergeOutputFile, "output", "o", "bloomfilter.gob", "output file path")
+	MergeCmd.Flags().BoolVar(&mergeIntersect, "intersect", false, "keep the addresses in every input instead of in any")
+	MergeCmd.Flags().StringVarP(&mergeSource, "source", "s", "", "source label recorded in the file header")
+	mergeSecure.register(MergeCmd)
+	mergeInSecure.registerWithPrefix(MergeCmd, "in-", "input files, if they use other keys than the output: ")
+}
+
+func runMerge(_ *cobra.Command, args []string) {
+	handler, err := mergeSecure.handler()
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+	opts, err := inputOptions(&mergeInSecure, &mergeSecure)
+	if err != nil {
+		fmt.Println("Error loading keys:", err)
+		os.Exit(-1)
+	}
+
+	// The output is signed and encrypted with the output keys, not those the inputs were read with.
+	outOpts := []store.Option{store.WithSecureDataHandler(handler), store.WithSource(mergeSource)}
+	combine := store.Merge
+	if mergeIntersect {
+		combine = store.Intersect
+	}
+	var result *store.BloomFilterStore
+	for _, filePath := range args {
+		addressHandler, err := store.ReadAddressHandler(filePath)
+		if err != nil {
+			fmt.Println("Error reading header:", err)
+			os.Exit(-1)
+		}
+		filter, err := store.NewBloomFilterStoreFromFile(filePath, addressHandler, opts...)
+		if err != nil {
+			fmt.Println("Error opening file:", err)
+			os.Exit(-1)
+		}
+		if result == nil {
+			result = filter
+			continue
+		}
+		if result, err = combine(result, filter, outOpts...); err != nil {
+			fmt.Printf("Error combining %s: %v\n", filePath, err)
+			os.Exit(-1)
+		}
+	}
+
+	if err := result.SaveToFile(mergeOutputFile); err != nil {
+		fmt.Println("Error saving Bloom filter:", err)
+		os.Exit(-1)
+	}
+	fmt.Println("Bloom filter has been serialized successfully.")
+}
@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"addressdb/store"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var PlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Compute the size and false positive rate of Bloom filters for a number of addresses",
+	Run:   runPlan,
+}
+
+var (
+	planCount   uint
+	planRate    float64
+	planMaxSize string
+	planJSON    bool
+)
+
+// planGrowth are the multiples of the expected count at which the false positive rate of a plan is listed.
+var planGrowth = []float64{0.5, 1, 1.5, 2, 4}
+
+func init() {
+	PlanCmd.Flags().UintVarP(&planCount, "number", "n", 0, "number of elements expected")
+	PlanCmd.Flags().Float64VarP(&planRate, "probability", "p", 0, "target false positive probability")
+	PlanCmd.Flags().StringVar(&planMaxSize, "max-size", "", "maximum file size, in bytes or with a K, M or G suffix, instead of -p")
+	PlanCmd.Flags().BoolVar(&planJSON, "json", false, "print the result as JSON")
+}
+
+func runPlan(_ *cobra.Command, _ []string) {
+	if planCount == 0 {
+		fmt.Println("Error: the number of elements (-n) is required")
+		os.Exit(-1)
+	}
+
+	var plan *store.Plan
+	switch {
+	case planMaxSize != "":
+		maxSize, err := parseSize(planMaxSize)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(-1)
+		}
+		p, err := store.PlanForSize(planCount, maxSize)
+		if err != nil {
+			fmt.Println("Error planning filter:", err)
+			os.Exit(-1)
+		}
+		plan = &p
+	case planRate != 0:
+		p, err := store.PlanForRate(planCount, planRate)
+		if err != nil {
+			fmt.Println("Error planning filter:", err)
+			os.Exit(-1)
+		}
+		plan = &p
+	}
+	table, err := store.PlanTable(planCount)
+	if err != nil {
+		fmt.Println("Error planning filter:", err)
+		os.Exit(-1)
+	}
+
+	type growth struct {
+		Count             uint    `json:"count"`
+		FalsePositiveRate float64 `json:"false_positive_rate"`
+	}
+	var growths []growth
+	if plan != nil {
+		for _, factor := range planGrowth {
+			count := uint(float64(planCount) * factor)
+			growths = append(growths, growth{Count: count, FalsePositiveRate: plan.RateAt(count)})
+		}
+	}
+
+	if planJSON {
+		result := struct {
+			Plan   *store.Plan  `json:"plan,omitempty"`
+			Growth []growth     `json:"growth,omitempty"`
+			Rates  []store.Plan `json:"rates"`
+		}{plan, growths, table}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Println("Error encoding JSON:", err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if plan != nil {
+		fmt.Printf("Elements (n):           %d\n", plan.Count)
+		fmt.Printf("Size (m):               %d bits\n", plan.Bits)
+		fmt.Printf("Hash functions (k):     %d\n", plan.HashFunctions)
+		fmt.Printf("File size:              %s\n", formatSize(plan.FileSize))
+		fmt.Printf("Expected FPR:           %.3g\n", plan.FalsePositiveRate)
+		fmt.Println()
+		fmt.Printf("%14s  %14s\n", "Elements", "Expected FPR")
+		for _, g := range growths {
+			fmt.Printf("%14d  %14.3g\n", g.Count, g.FalsePositiveRate)
+		}
+		fmt.Println()
+	}
+	fmt.Printf("%14s  %16s  %4s  %12s\n", "Target FPR", "Size (m)", "k", "File size")
+	for _, p := range table {
+		fmt.Printf("%14.0e  %16d  %4d  %12s\n", p.FalsePositiveRate, p.Bits, p.HashFunctions, formatSize(p.FileSize))
+	}
+}
+
+// parseSize parses a size in bytes, optionally followed by a K, M or G suffix for powers of 1024.
+func parseSize(value string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a size in bytes with a binary unit.
+func formatSize(n int64) string {
+	size, unit := float64(n), "B"
+	for _, next := range []string{"KiB", "MiB", "GiB"} {
+		if size < 1024 {
+			break
+		}
+		size, unit = size/1024, next
+	}
+	if unit == "B" {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"addressdb/address"
+	"addressdb/commitment"
+	"addressdb/store"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var ProveCmd = &cobra.Command{
+	Use:   "prove <address>",
+	Short: "Prove that an address is or is not in a committed filter",
+	Args:  cobra.ExactArgs(1),
+	Run:   runProve,
+}
+
+var VerifyProofCmd = &cobra.Command{
+	Use:   "verify-proof",
+	Short: "Verify a proof written by prove against a trusted Merkle root",
+	Run:   runVerifyProof,
+}
+
+var (
+	proveFilename   string
+	proveOutputFile string
+	proveSecure     secureFlags
+
+	verifyProofFile string
+	verifyFilename  string
+	verifyRoot      string
+)
+
+func init() {
+	ProveCmd.Flags().StringVarP(&proveFilename, "file", "f", "bloomfilter.gob", "Path to the filter file, with its commitment next to it")
+	ProveCmd.Flags().StringVarP(&proveOutputFile, "output", "o", "", "output file for the proof (default stdout)")
+	proveSecure.register(ProveCmd)
+
+	VerifyProofCmd.Flags().StringVarP(&verifyProofFile, "proof", "p", "proof.json", "path to the proof")
+	VerifyProofCmd.Flags().StringVarP(&verifyFilename, "file", "f", "", "path to a trusted copy of the filter file, whose header holds the root")
+	VerifyProofCmd.Flags().StringVar(&verifyRoot, "root", "", "trusted hex Merkle root, instead of --file")
+}
+
+// proofFile is the proof written by prove: a membership proof with the list metadata it refers to.
+type proofFile struct {
+	Address     string    `json:"address"`
+	AddressType string    `json:"address_type"`
+	Source      string    `json:"source,omitempty"`
+	BuildTime   time.Time `json:"build_time"`
+	commitment.MembershipProof
+}
+
+func runProve(_ *cobra.Command, args []string) {
+	filter, tree, addressHandler, err := loadCommitment(proveFilename, proveSecure)
+	if err != nil {
+		fmt.Println("Error loading commitment:", err)
+		os.Exit(-1)
+	}
+
+	proof, err := commitment.NewProver(tree, addressHandler).ProveMembership(args[0])
+	if err != nil {
+		fmt.Println("Error proving:", err)
+		os.Exit(-1)
+	}
+
+	metadata := filter.Metadata()
+	result := proofFile{
+		Address:         args[0],
+		AddressType:     addressHandler.Type(),
+		Source:          metadata.Source,
+		BuildTime:       metadata.BuildTime,
+		MembershipProof: *proof,
+	}
+
+	var w io.Writer = os.Stdout
+	if proveOutputFile != "" {
+		file, err := os.Create(proveOutputFile)
+		if err != nil {
+			fmt.Println("Error creating file:", err)
+			os.Exit(-1)
+		}
+		defer file.Close()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Println("Error writing proof:", err)
+		os.Exit(-1)
+	}
+}
+
+func runVerifyProof(_ *cobra.Command, _ []string) {
+	root, err := trustedRoot()
+	if err != nil {
+		fmt.Println("Error reading root:", err)
+		os.Exit(-1)
+	}
+
+	data, err := os.ReadFile(verifyProofFile)
+	if err != nil {
+		fmt.Println("Error reading proof:", err)
+		os.Exit(-1)
+	}
+	var proof proofFile
+	if err := json.Unmarshal(data, &proof); err != nil {
+		fmt.Println("Error decoding proof:", err)
+		os.Exit(-1)
+	}
+
+	addressHandler, err := address.NewAddressHandler(proof.AddressType)
+	if err != nil {
+		fmt.Println("Error reading proof:", err)
+		os.Exit(-1)
+	}
+	leaf, err := commitment.Leaf(addressHandler, proof.Address)
+	if err != nil {
+		fmt.Println("Invalid address in proof:", err)
+		os.Exit(-1)
+	}
+
+	included, err := proof.Verify(root, leaf)
+	if err != nil {
+		fmt.Println("Invalid proof:", err)
+		os.Exit(-1)
+	}
+	if included {
+		fmt.Printf("Valid proof: %s is in the list with root %x\n", proof.Address, root)
+	} else {
+		fmt.Printf("Valid proof: %s is NOT in the list with root %x\n", proof.Address, root)
+	}
+}
+
+// loadCommitment loads a filter file with the keys of secure, and the Merkle tree written next to it.
+func loadCommitment(filePath string, secure secureFlags) (*store.BloomFilterStore, *commitment.Tree, address.AddressHandler, error) {
+	addressHandler, err := store.ReadAddressHandler(filePath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	opts, err := secure.options()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load keys: %w", err)
+	}
+	filter, err := store.NewBloomFilterStoreFromFile(filePath, addressHandler, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tree, err := filter.LoadCommitment(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return filter, tree, addressHandler, nil
+}
+
+// trustedRoot returns the root given with --root, or read from the header of --file.
+func trustedRoot() ([]byte, error) {
+	switch {
+	case verifyRoot != "" && verifyFilename != "":
+		return nil, fmt.Errorf("--root and --file are mutually exclusive")
+	case verifyRoot != "":
+		return hex.DecodeString(verifyRoot)
+	case verifyFilename != "":
+		f, err := os.Open(verifyFilename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		metadata, err := store.ReadMetadata(f)
+		if err != nil {
+			return nil, err
+		}
+		if metadata.MerkleRoot == "" {
+			return nil, fmt.Errorf("filter has no commitment")
+		}
+		return hex.DecodeString(metadata.MerkleRoot)
+	}
+	return nil, fmt.Errorf("one of --root or --file is required")
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"addressdb/oprf"
+	"addressdb/securedata"
+	"addressdb/store"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// secureFlags holds the key flags used to read or write encrypted, signed and keyed filter files.
+type secureFlags struct {
+	privateKeyPath string
+	publicKeyPath  string
+	passphrase     string
+	hashKeyPath    string
+	oprfKeyPath    string
+	oprfServer     string
+}
+
+func (f *secureFlags) register(cmd *cobra.Command) {
+	f.registerWithPrefix(cmd, "", "")
+}
+
+// registerWithPrefix registers the flags with names starting with prefix, for commands reading and
+// writing files with different keys. The usage of each flag starts with what if it is not empty.
+func (f *secureFlags) registerWithPrefix(cmd *cobra.Command, prefix, what string) {
+	cmd.Flags().StringVar(&f.privateKeyPath, prefix+"private-key", "", what+"path to the armored PGP private key (decrypts when reading, signs when writing)")
+	cmd.Flags().StringVar(&f.publicKeyPath, prefix+"public-key", "", what+"path to the armored PGP public key (verifies when reading, encrypts when writing)")
+	cmd.Flags().StringVar(&f.passphrase, prefix+"passphrase", "", what+"passphrase of the private key")
+	cmd.Flags().StringVar(&f.hashKeyPath, prefix+"hash-key", "", what+"path to the key addresses are hashed with, encrypted if PGP keys are given")
+	cmd.Flags().StringVar(&f.oprfKeyPath, prefix+"oprf-key", "", what+"path to the OPRF key addresses are hashed with, encrypted if PGP keys are given")
+	cmd.Flags().StringVar(&f.oprfServer, prefix+"oprf-server", "", what+"URL of a server evaluating the OPRF, to hash addresses without revealing them")
+}
+
+// options returns the store options for the configured keys, or none if no key was given.
+func (f *secureFlags) options() ([]store.Option, error) {
+	handler, err := f.handler()
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []store.Option
+	if handler != nil {
+		opts = append(opts, store.WithSecureDataHandler(handler))
+	}
+	if f.hashKeyPath != "" {
+		key, err := readHashKey(f.hashKeyPath, handler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hash key: %w", err)
+		}
+		opts = append(opts, store.WithHashKey(key))
+	}
+
+	hasher, err := f.oprfHasher(handler)
+	if err != nil {
+		return nil, err
+	}
+	if hasher != nil {
+		opts = append(opts, store.WithAddressHasher(hasher))
+	}
+	return opts, nil
+}
+
+// oprfHasher returns the OPRF key or client for the configured flags, or nil if none was given.
+func (f *secureFlags) oprfHasher(handler securedata.SecureDataHandler) (store.AddressHasher, error) {
+	set := 0
+	for _, value := range []string{f.hashKeyPath, f.oprfKeyPath, f.oprfServer} {
+		if value != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("--hash-key, --oprf-key and --oprf-server are mutually exclusive")
+	}
+
+	switch {
+	case f.oprfKeyPath != "":
+		data, err := readHashKey(f.oprfKeyPath, handler)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OPRF key: %w", err)
+		}
+		return oprf.NewKey(data)
+	case f.oprfServer != "":
+		return oprf.NewClient(context.Background(), f.oprfServer, nil)
+	}
+	return nil, nil
+}
+
+// handler returns the SecureDataHandler for the configured PGP keys, or nil if none was given.
+func (f *secureFlags) handler() (securedata.SecureDataHandler, error) {
+	if f.privateKeyPath == "" && f.publicKeyPath == "" {
+		return nil, nil
+	}
+	var keyOpts []securedata.Option
+	if f.privateKeyPath != "" {
+		keyOpts = append(keyOpts, securedata.WithPrivateKeyPath(f.privateKeyPath, f.passphrase))
+	}
+	if f.publicKeyPath != "" {
+		keyOpts = append(keyOpts, securedata.WithPublicKeyPath(f.publicKeyPath))
+	}
+	return securedata.NewPGPSecureHandler(keyOpts...)
+}
+
+// readHashKey reads a hash key file, decrypting it with handler if one is given.
+func readHashKey(filePath string, handler securedata.SecureDataHandler) ([]byte, error) {
+	if handler == nil {
+		return os.ReadFile(filePath)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return securedata.ReadSecret(handler, f)
+}
+
+// inputOptions returns the store options for reading input files with the in flags, falling back
+// to out if none of them was given.
+func inputOptions(in, out *secureFlags) ([]store.Option, error) {
+	if *in == (secureFlags{}) {
+		return out.options()
+	}
+	return in.options()
+}
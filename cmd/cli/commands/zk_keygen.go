@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"addressdb/zk"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var ZKKeyGenCmd = &cobra.Command{
+	Use:   "zk-keygen",
+	Short: "Generate the parameters of zero-knowledge membership proofs for a committed filter",
+	Long: `Generate the parameters of zero-knowledge membership and non-membership proofs for a committed filter.
+
+The setup is transparent: the parameters are derived from the filter's Merkle tree alone, without
+secret randomness, and serve as both proving and verifying key. They hold the Merkle root and the
+leaf hashes of the tree rather than the addresses, and are checked against the root when read.
+Anyone holding them can still test whether a given address is listed.`,
+	Run: runZKKeyGen,
+}
+
+var (
+	zkFilename   string
+	zkOutputFile string
+	zkSecure     secureFlags
+)
+
+func init() {
+	ZKKeyGenCmd.Flags().StringVarP(&zkFilename, "file", "f", "bloomfilter.gob", "Path to the filter file, with its commitment next to it")
+	ZKKeyGenCmd.Flags().StringVarP(&zkOutputFile, "output", "o", "zk.params", "output file for the parameters")
+	zkSecure.register(ZKKeyGenCmd)
+}
+
+func runZKKeyGen(_ *cobra.Command, _ []string) {
+	_, tree, _, err := loadCommitment(zkFilename, zkSecure)
+	if err != nil {
+		fmt.Println("Error loading commitment:", err)
+		os.Exit(-1)
+	}
+	params, err := zk.Setup(tree)
+	if err != nil {
+		fmt.Println("Error generating parameters:", err)
+		os.Exit(-1)
+	}
+
+	file, err := os.Create(zkOutputFile)
+	if err != nil {
+		fmt.Println("Error creating file:", err)
+		os.Exit(-1)
+	}
+	defer file.Close()
+	if _, err := params.WriteTo(file); err != nil {
+		fmt.Println("Error writing parameters:", err)
+		os.Exit(-1)
+	}
+	fmt.Printf("Parameters for %d addresses with root %x written to %s\n", tree.Len(), params.Root(), zkOutputFile)
+}
@@ -16,6 +16,14 @@ func main() {
 	rootCmd.AddCommand(commands.CheckCmd)
 	rootCmd.AddCommand(commands.BatchCheckCmd)
 	rootCmd.AddCommand(commands.AddressGenCmd)
+	rootCmd.AddCommand(commands.InspectCmd)
+	rootCmd.AddCommand(commands.KeyGenCmd)
+	rootCmd.AddCommand(commands.ProveCmd)
+	rootCmd.AddCommand(commands.VerifyProofCmd)
+	rootCmd.AddCommand(commands.ZKKeyGenCmd)
+	rootCmd.AddCommand(commands.DiffCmd)
+	rootCmd.AddCommand(commands.MergeCmd)
+	rootCmd.AddCommand(commands.PlanCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -7,15 +7,22 @@ Example server for the Bloom filter, should be good enough as OOB solution
 */
 import (
 	"addressdb/address"
+	"addressdb/commitment"
+	"addressdb/oprf"
 	"addressdb/reload"
 	"addressdb/store"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"strconv"
@@ -25,11 +32,13 @@ import (
 )
 
 var (
-	filter    *store.BloomFilterStore
-	logger    = log.New(os.Stdout, "BloomServer: ", log.LstdFlags)
-	lasterror error
-	ratelimit int
-	burst     int
+	filters     = store.NewMultiStore()
+	commitments = make(map[string]*listCommitment)
+	histories   = make(map[string]*store.History)
+	logger      = log.New(os.Stdout, "BloomServer: ", log.LstdFlags)
+	lasterror   error
+	ratelimit   int
+	burst       int
 )
 
 type Response struct {
@@ -38,40 +47,157 @@ type Response struct {
 	Message string `json:"message"`
 }
 
+// fileList collects repeated -f flags of the form label=path, or just path.
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// labelAndPath splits a -f value into its label and path. Without a label, the file name
+// without extension is used.
+func labelAndPath(value string) (string, string) {
+	if label, path, ok := strings.Cut(value, "="); ok {
+		return label, path
+	}
+	return strings.TrimSuffix(filepath.Base(value), filepath.Ext(value)), value
+}
+
+// readKeyID returns the id of the hash key a filter file is keyed with, "" if it is not keyed.
+func readKeyID(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	metadata, err := store.ReadMetadata(f)
+	if errors.Is(err, store.ErrLegacyFormat) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return metadata.KeyID, nil
+}
+
 func main() {
-	filename := flag.String("f", "bloomfilter.gob", "Path to the .gob file containing the Bloom filter")
+	var filenames fileList
+	flag.Var(&filenames, "f", "Path to a .gob file containing a Bloom filter, as label=path or path; repeat for several lists (default bloomfilter.gob)")
 	port := flag.Int("p", 8080, "Port to listen on")
 	ratelimit_v := flag.Int("r", 20, "Ratelimit")
 	burst_v := flag.Int("b", 5, "Burst")
+	oprfKeyPath := flag.String("oprf-key", "", "Path to an OPRF key; enables the /oprf endpoints for oblivious checks, and checks lists built with it")
+	mmap := flag.Bool("mmap", false, "Map unencrypted Bloom filter files in memory instead of reading them")
+	historyDir := flag.String("history", "", "Directory keeping a version of each list per reload, in a subdirectory per label; enables the 'at' parameter")
+	var retention store.RetentionPolicy
+	flag.IntVar(&retention.MaxVersions, "history-max-versions", 0, "Number of versions kept per list, 0 for no limit")
+	flag.DurationVar(&retention.MaxAge, "history-max-age", 0, "How far back the 'at' parameter is answered, 0 for no limit")
+	flag.DurationVar(&retention.DailyAfter, "history-daily-after", 0, "Keep one version per day of versions older than this, 0 to keep them all")
 	flag.Parse()
 
 	// Use the values
 	ratelimit = *ratelimit_v
 	burst = *burst_v
-	addressHandler := &address.EVMAddressHandler{}
-	filter, lasterror = store.NewBloomFilterStoreFromFile(*filename, addressHandler)
-
-	if lasterror != nil {
-		logger.Fatalf("Failed to load Bloom filter: %v", lasterror)
+	if len(filenames) == 0 {
+		filenames = fileList{"bloomfilter.gob"}
 	}
 
-	// Create a file watcher notifier.
-	notifier, err := reload.NewFileWatcherNotifier(*filename, 2*time.Second)
-	if err != nil {
-		log.Fatalf("Error creating file watcher notifier: %v", err)
+	var oprfKey *oprf.Key
+	opts := []store.Option{store.WithAddressInfo()}
+	if *mmap {
+		opts = append(opts, store.WithMmap())
+	}
+	if *oprfKeyPath != "" {
+		data, err := os.ReadFile(*oprfKeyPath)
+		if err != nil {
+			logger.Fatalf("Failed to read OPRF key: %v", err)
+		}
+		if oprfKey, err = oprf.NewKey(data); err != nil {
+			logger.Fatalf("Failed to load OPRF key: %v", err)
+		}
 	}
 
-	// Create the ReloadManager with the notifier.
-	manager := reload.NewReloadManager(filter, notifier)
-	if err := manager.Start(context.Background()); err != nil {
-		log.Fatalf("Error starting Bloom filter manager: %v", err)
+	var managers []*reload.ReloadManager
+	for _, value := range filenames {
+		label, filename := labelAndPath(value)
+		addressHandler, err := store.ReadAddressHandler(filename)
+		if err != nil {
+			logger.Fatalf("Failed to read the header of %s: %v", filename, err)
+		}
+
+		// Lists built over OPRF outputs are checked with the key the server evaluates with; the
+		// others are loaded as they are.
+		listOpts := opts
+		if oprfKey != nil {
+			keyID, err := readKeyID(filename)
+			if err != nil {
+				logger.Fatalf("Failed to read the header of %s: %v", filename, err)
+			}
+			if keyID == oprfKey.KeyID() {
+				listOpts = append(opts[:len(opts):len(opts)], store.WithAddressHasher(oprfKey))
+			}
+		}
+
+		var filter *store.BloomFilterStore
+		filter, lasterror = store.NewBloomFilterStoreFromFile(filename, addressHandler, listOpts...)
+		if lasterror != nil {
+			logger.Fatalf("Failed to load Bloom filter %s: %v", filename, lasterror)
+		}
+		if err := filters.Set(label, filter); err != nil {
+			logger.Fatalf("Failed to register Bloom filter %s: %v", filename, err)
+		}
+
+		var history *store.History
+		if *historyDir != "" {
+			if history, lasterror = store.NewHistory(filepath.Join(*historyDir, label), addressHandler, retention, listOpts...); lasterror != nil {
+				logger.Fatalf("Failed to open history of %s: %v", filename, lasterror)
+			}
+			if _, err := history.Add(filter, time.Now()); err != nil {
+				logger.Fatalf("Failed to record %s in its history: %v", filename, err)
+			}
+			histories[label] = history
+		}
+
+		// Reload the list when it is replaced, and apply deltas published next to it.
+		for _, watched := range []string{filename, store.DeltaPath(filename)} {
+			// Create a file watcher notifier.
+			notifier, err := reload.NewFileWatcherNotifier(watched, 2*time.Second)
+			if err != nil {
+				log.Fatalf("Error creating file watcher notifier: %v", err)
+			}
+			var watcher reload.Notifier = notifier
+			if history != nil {
+				watcher = &historyNotifier{Notifier: notifier, label: label, filter: filter, history: history}
+			}
+
+			// Create the ReloadManager with the notifier.
+			manager := reload.NewReloadManager(filter, watcher)
+			if err := manager.Start(context.Background()); err != nil {
+				log.Fatalf("Error starting Bloom filter manager: %v", err)
+			}
+			managers = append(managers, manager)
+		}
+
+		if filter.Metadata().MerkleRoot != "" {
+			commitments[label] = &listCommitment{filePath: filename, store: filter}
+		}
+		logger.Printf("Loaded list %q from %s", label, filename)
 	}
-	defer manager.Stop()
 
 	r := mux.NewRouter()
 	r.Use(loggingMiddleware)
 	r.Handle("/check", rateLimitMiddleware(http.HandlerFunc(checkHandler))).Methods("GET")
 	r.Handle("/checkBatch", rateLimitMiddleware(http.HandlerFunc(checkBatchHandler))).Methods("POST")
+	r.Handle("/proof", rateLimitMiddleware(http.HandlerFunc(proofHandler))).Methods("GET")
+	if oprfKey != nil {
+		r.Handle("/oprf/key", oprf.PublicKeyHandler(oprfKey)).Methods("GET")
+		r.Handle("/oprf/evaluate", rateLimitMiddleware(oprf.EvaluateHandler(oprfKey))).Methods("POST")
+		logger.Printf("OPRF endpoints enabled with key %s", oprfKey.KeyID())
+	}
 
 	srv := &http.Server{
 		Addr:         ":" + strconv.Itoa(*port),
@@ -82,13 +208,13 @@ func main() {
 	}
 
 	go func() {
-		logger.Printf("Starting server on port %s", port)
+		logger.Printf("Starting server on port %d", *port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Could not listen on %s: %v\n", port, err)
+			logger.Fatalf("Could not listen on %d: %v\n", *port, err)
 		}
 	}()
 
-	gracefulShutdown(srv)
+	gracefulShutdown(srv, managers)
 }
 func checkHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("s")
@@ -97,16 +223,43 @@ func checkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	found, err := filter.CheckAddress(query)
+	lists, release, ok := listsAt(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
+	// Lists only fail to check a query they all reject as invalid.
+	categories, err := lists.CheckAddress(query)
 	if err != nil {
-		http.Error(w, `{"error": "Internal server error"}`, http.StatusBadRequest)
+		http.Error(w, `{"error": "Invalid address"}`, http.StatusBadRequest)
 		return
 	}
 
+	// Matches are definite when every matching list has an exact tier.
+	exact := true
+	info := make(map[string][]store.AddressInfo)
+	for _, label := range categories {
+		filter, ok := lists.Store(label)
+		if !ok {
+			continue
+		}
+		exact = exact && filter.Exact()
+		if entries, err := filter.LookupAddress(query); err == nil && len(entries) > 0 {
+			info[label] = entries
+		}
+	}
+
 	response := struct {
-		Found bool `json:"found"`
+		Found      bool                           `json:"found"`
+		Exact      bool                           `json:"exact"`
+		Categories []string                       `json:"categories"`
+		Info       map[string][]store.AddressInfo `json:"info,omitempty"`
 	}{
-		Found: found,
+		Found:      len(categories) > 0,
+		Exact:      exact,
+		Categories: categories,
+		Info:       info,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -131,26 +284,37 @@ func checkBatchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	lists, release, ok := listsAt(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+
 	// Check each address against the Bloom filter
 	found := make([]string, 0)
 	notFound := make([]string, 0)
+	categories := make(map[string][]string)
 
-	for _, address := range requestBody.Addresses {
-		if ok, err := filter.CheckAddress(address); ok && err == nil {
+	matches, errs := lists.CheckAddresses(requestBody.Addresses)
+	for i, address := range requestBody.Addresses {
+		if len(matches[i]) > 0 && errs[i] == nil {
 			found = append(found, address)
+			categories[address] = matches[i]
 		} else {
 			notFound = append(notFound, address)
 		}
 	}
 
 	var resultsMerged struct {
-		Found         []string `json:"found"`
-		NotFound      []string `json:"notfound"`
-		FoundCount    int      `json:"found_count"`
-		NotFoundCount int      `json:"notfound_count"`
+		Found         []string            `json:"found"`
+		NotFound      []string            `json:"notfound"`
+		FoundCount    int                 `json:"found_count"`
+		NotFoundCount int                 `json:"notfound_count"`
+		Categories    map[string][]string `json:"categories"`
 	}
 
 	resultsMerged.Found = found
+	resultsMerged.Categories = categories
 	resultsMerged.NotFound = notFound
 	resultsMerged.FoundCount = len(found)
 	resultsMerged.NotFoundCount = len(notFound)
@@ -162,6 +326,149 @@ func checkBatchHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// listsAt returns the lists to check a request against: the loaded lists or, if the request has an
+// 'at' parameter, the versions of the lists in effect at that time. 'at' is an RFC 3339 time or a
+// date, standing for the end of that day in UTC. Lists without a version at that time are left out.
+// release must be called once the request is done with the lists. On failure, the error is written
+// to w and ok is false.
+func listsAt(w http.ResponseWriter, r *http.Request) (lists *store.MultiStore, release func(), ok bool) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		return filters, func() {}, true
+	}
+	if len(histories) == 0 {
+		http.Error(w, `{"error": "History is not enabled"}`, http.StatusBadRequest)
+		return nil, nil, false
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		day, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid 'at' parameter"}`, http.StatusBadRequest)
+			return nil, nil, false
+		}
+		at = day.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	// The versions are released together, so that evicted ones are closed once no request uses them.
+	var releases []func()
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+	lists = store.NewMultiStore()
+	for label, history := range histories {
+		filter, _, releaseVersion, err := history.At(at)
+		if errors.Is(err, store.ErrNoVersion) {
+			continue
+		} else if err != nil {
+			release()
+			logger.Printf("Failed to load list %q at %s: %v", label, value, err)
+			http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		releases = append(releases, releaseVersion)
+		lists.Set(label, filter)
+	}
+	if len(lists.Labels()) == 0 {
+		http.Error(w, `{"error": "No version at the requested time"}`, http.StatusNotFound)
+		return nil, nil, false
+	}
+	return lists, release, true
+}
+
+// historyNotifier records a version of a list in its history after every reload.
+type historyNotifier struct {
+	reload.Notifier
+	label   string
+	filter  *store.BloomFilterStore
+	history *store.History
+}
+
+func (n *historyNotifier) WatchForChange(ctx context.Context, onReload func(file string) error) error {
+	return n.Notifier.WatchForChange(ctx, func(file string) error {
+		if err := onReload(file); err != nil {
+			return err
+		}
+		if _, err := n.history.Add(n.filter, time.Now()); err != nil {
+			logger.Printf("Failed to record list %q in its history: %v", n.label, err)
+		}
+		return nil
+	})
+}
+
+// listCommitment holds the Merkle tree written next to a list file. The tree is reloaded when the
+// root in the header of the list changes, i.e. after the ReloadManager reloaded the list.
+type listCommitment struct {
+	filePath string
+	store    *store.BloomFilterStore
+	tree     *commitment.Tree
+	mu       sync.Mutex
+}
+
+func (c *listCommitment) Tree() (*commitment.Tree, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tree == nil || hex.EncodeToString(c.tree.Root()) != c.store.Metadata().MerkleRoot {
+		tree, err := c.store.LoadCommitment(c.filePath)
+		if err != nil {
+			return nil, err
+		}
+		c.tree = tree
+	}
+	return c.tree, nil
+}
+
+// proofHandler returns, for every list with a commitment, the root and a proof that the address is
+// or is not in the list. Non-membership proofs hold the listed addresses around the queried one, so
+// the proofs reveal the list to whoever can query them.
+func proofHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("s")
+	if query == "" {
+		http.Error(w, `{"error": "Missing 's' parameter"}`, http.StatusBadRequest)
+		return
+	}
+
+	// Lists holding other kinds of elements than the query are skipped.
+	proofs := make(map[string]*commitment.MembershipProof)
+	for label, c := range commitments {
+		addressHandler, err := address.NewAddressHandler(c.store.Metadata().AddressType)
+		if err != nil {
+			continue
+		}
+		leaf, err := commitment.Leaf(addressHandler, query)
+		if err != nil {
+			continue
+		}
+		tree, err := c.Tree()
+		if err == nil {
+			proofs[label], err = tree.ProveMembership(leaf)
+		}
+		if err != nil {
+			logger.Printf("Failed to prove against list %q: %v", label, err)
+			http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if len(proofs) == 0 && len(commitments) > 0 {
+		http.Error(w, `{"error": "Invalid address"}`, http.StatusBadRequest)
+		return
+	}
+
+	response := struct {
+		Address string                                 `json:"address"`
+		Proofs  map[string]*commitment.MembershipProof `json:"proofs"`
+	}{
+		Address: query,
+		Proofs:  proofs,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -187,7 +494,7 @@ func rateLimitMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func gracefulShutdown(srv *http.Server) {
+func gracefulShutdown(srv *http.Server, managers []*reload.ReloadManager) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
@@ -196,6 +503,12 @@ func gracefulShutdown(srv *http.Server) {
 	defer cancel()
 
 	srv.Shutdown(ctx)
+	// Stop the reload managers here: deferred calls do not run on os.Exit.
+	for _, manager := range managers {
+		if err := manager.Stop(); err != nil {
+			logger.Printf("Error stopping reload manager: %v", err)
+		}
+	}
 	logger.Println("shutting down")
 	os.Exit(0)
 }
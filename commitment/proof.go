@@ -0,0 +1,173 @@
+package commitment
+
+import (
+	"addressdb/address"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrIncluded is returned when proving the non-membership of a leaf that is in the tree.
+var ErrIncluded = errors.New("leaf is in tree")
+
+// Neighbor is a leaf of the tree with its inclusion proof.
+type Neighbor struct {
+	Leaf  []byte `json:"leaf"`
+	Proof *Proof `json:"proof"`
+}
+
+// NonMembershipProof proves that a leaf is not in a tree by proving the inclusion of the two
+// adjacent leaves it would sit between. Left is nil if the leaf would be first, Right if it would
+// be last; both are nil for an empty tree.
+type NonMembershipProof struct {
+	Left  *Neighbor `json:"left,omitempty"`
+	Right *Neighbor `json:"right,omitempty"`
+}
+
+// ProveNonMembership returns a proof that leaf is not in the tree, or ErrIncluded.
+func (t *Tree) ProveNonMembership(leaf []byte) (*NonMembershipProof, error) {
+	i, found := t.Search(leaf)
+	if found {
+		return nil, ErrIncluded
+	}
+
+	proof := &NonMembershipProof{}
+	if i > 0 {
+		inclusion, err := t.ProveIndex(i - 1)
+		if err != nil {
+			return nil, err
+		}
+		proof.Left = &Neighbor{Leaf: t.leaves[i-1], Proof: inclusion}
+	}
+	if i < len(t.leaves) {
+		inclusion, err := t.ProveIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		proof.Right = &Neighbor{Leaf: t.leaves[i], Proof: inclusion}
+	}
+	return proof, nil
+}
+
+// VerifyNonMembership checks that proof proves leaf is not in the tree with the given root.
+func VerifyNonMembership(root, leaf []byte, proof *NonMembershipProof) error {
+	if proof == nil {
+		return errors.New("missing proof")
+	}
+	left, right := proof.Left, proof.Right
+	if left == nil && right == nil {
+		if !bytes.Equal(root, New(nil).Root()) {
+			return errors.New("proof has no neighbors but the tree is not empty")
+		}
+		return nil
+	}
+
+	if left != nil {
+		if err := VerifyInclusion(root, left.Leaf, left.Proof); err != nil {
+			return fmt.Errorf("invalid left neighbor: %w", err)
+		}
+		if bytes.Compare(left.Leaf, leaf) >= 0 {
+			return errors.New("left neighbor is not below the leaf")
+		}
+	}
+	if right != nil {
+		if err := VerifyInclusion(root, right.Leaf, right.Proof); err != nil {
+			return fmt.Errorf("invalid right neighbor: %w", err)
+		}
+		if bytes.Compare(leaf, right.Leaf) >= 0 {
+			return errors.New("right neighbor is not above the leaf")
+		}
+	}
+
+	switch {
+	case left == nil:
+		if right.Proof.Index != 0 {
+			return errors.New("right neighbor is not the first leaf")
+		}
+	case right == nil:
+		if left.Proof.Index != left.Proof.LeafCount-1 {
+			return errors.New("left neighbor is not the last leaf")
+		}
+	default:
+		if left.Proof.LeafCount != right.Proof.LeafCount || right.Proof.Index != left.Proof.Index+1 {
+			return errors.New("neighbors are not adjacent")
+		}
+	}
+	return nil
+}
+
+// MembershipProof proves that a leaf is or is not in the tree with root Root. Exactly one of
+// Proof and Exclusion is set, depending on Included.
+type MembershipProof struct {
+	Root      []byte              `json:"root"`
+	Included  bool                `json:"included"`
+	Proof     *Proof              `json:"proof,omitempty"`
+	Exclusion *NonMembershipProof `json:"exclusion,omitempty"`
+}
+
+// ProveMembership returns a proof that leaf is or is not in the tree.
+func (t *Tree) ProveMembership(leaf []byte) (*MembershipProof, error) {
+	proof := &MembershipProof{Root: t.Root()}
+	i, found := t.Search(leaf)
+	var err error
+	if found {
+		proof.Included = true
+		proof.Proof, err = t.ProveIndex(i)
+	} else {
+		proof.Exclusion, err = t.ProveNonMembership(leaf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// Verify checks the proof for leaf against root, which the client must take from a trusted copy of
+// the filter header rather than from the proof, and returns whether the leaf is included.
+func (p *MembershipProof) Verify(root, leaf []byte) (bool, error) {
+	if !bytes.Equal(p.Root, root) {
+		return false, errors.New("proof is for another root")
+	}
+	if p.Included {
+		return true, VerifyInclusion(root, leaf, p.Proof)
+	}
+	return false, VerifyNonMembership(root, leaf, p.Exclusion)
+}
+
+// Prover proves the membership or non-membership of addresses in a tree, canonicalizing them with
+// an AddressHandler.
+type Prover struct {
+	tree           *Tree
+	addressHandler address.AddressHandler
+}
+
+// NewProver creates a Prover for a tree built over addresses handled by addressHandler.
+func NewProver(tree *Tree, addressHandler address.AddressHandler) *Prover {
+	return &Prover{tree: tree, addressHandler: addressHandler}
+}
+
+// ProveMembership returns a proof that address is or is not in the tree.
+func (p *Prover) ProveMembership(address string) (*MembershipProof, error) {
+	leaf, err := Leaf(p.addressHandler, address)
+	if err != nil {
+		return nil, err
+	}
+	return p.tree.ProveMembership(leaf)
+}
+
+// ProveNonMembership returns a proof that address is not in the tree, or ErrIncluded.
+func (p *Prover) ProveNonMembership(address string) (*NonMembershipProof, error) {
+	leaf, err := Leaf(p.addressHandler, address)
+	if err != nil {
+		return nil, err
+	}
+	return p.tree.ProveNonMembership(leaf)
+}
+
+// Leaf validates an address and returns its leaf, the canonical bytes from addressHandler.
+func Leaf(addressHandler address.AddressHandler, address string) ([]byte, error) {
+	if err := addressHandler.Validate(address); err != nil {
+		return nil, err
+	}
+	return addressHandler.ToBytes(address)
+}
@@ -0,0 +1,85 @@
+package commitment
+
+import (
+	"addressdb/address"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonMembershipProofs(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 5, 8, 13} {
+		leaves := testLeaves(n)
+		tree := New(leaves)
+
+		// Leaves before the first, between every pair and after the last.
+		absent := [][]byte{[]byte("a"), []byte("z")}
+		for _, leaf := range leaves {
+			absent = append(absent, append(append([]byte{}, leaf...), 'x'))
+		}
+		for _, leaf := range absent {
+			proof, err := tree.ProveNonMembership(leaf)
+			require.NoError(t, err)
+			require.NoError(t, VerifyNonMembership(tree.Root(), leaf, proof), "n=%d leaf=%s", n, leaf)
+		}
+
+		for _, leaf := range leaves {
+			_, err := tree.ProveNonMembership(leaf)
+			require.ErrorIs(t, err, ErrIncluded)
+		}
+	}
+}
+
+func TestNonMembershipRejectsInvalidProofs(t *testing.T) {
+	leaves := testLeaves(8)
+	tree := New(leaves)
+	absent := []byte("leaf-00003x")
+	proof, err := tree.ProveNonMembership(absent)
+	require.NoError(t, err)
+
+	require.Error(t, VerifyNonMembership(tree.Root(), leaves[3], proof), "Expected error for an included leaf")
+	require.Error(t, VerifyNonMembership(tree.Root(), []byte("leaf-00005x"), proof), "Expected error for a leaf outside the neighbors")
+	require.Error(t, VerifyNonMembership(New(leaves[1:]).Root(), absent, proof), "Expected error for another root")
+
+	// Neighbors that are both in the tree but not adjacent hide the leaves in between.
+	gap, err := tree.ProveNonMembership([]byte("leaf-00005x"))
+	require.NoError(t, err)
+	require.Error(t, VerifyNonMembership(tree.Root(), []byte("leaf-00004"), &NonMembershipProof{Left: proof.Left, Right: gap.Right}))
+
+	// Dropping a neighbor is only valid at the ends of the tree.
+	require.Error(t, VerifyNonMembership(tree.Root(), absent, &NonMembershipProof{Left: proof.Left}))
+	require.Error(t, VerifyNonMembership(tree.Root(), absent, &NonMembershipProof{Right: proof.Right}))
+	require.Error(t, VerifyNonMembership(tree.Root(), absent, &NonMembershipProof{}))
+}
+
+func TestProverAddresses(t *testing.T) {
+	handler := &address.EVMAddressHandler{}
+	included := "0x1234567890123456789012345678901234567890"
+	excluded := "0x0000000000000000000000000000000000000001"
+	leaf, err := Leaf(handler, included)
+	require.NoError(t, err)
+	tree := New([][]byte{leaf})
+	prover := NewProver(tree, handler)
+
+	proof, err := prover.ProveMembership(included)
+	require.NoError(t, err)
+	found, err := proof.Verify(tree.Root(), leaf)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	excludedLeaf, err := Leaf(handler, excluded)
+	require.NoError(t, err)
+	proof, err = prover.ProveMembership(excluded)
+	require.NoError(t, err)
+	found, err = proof.Verify(tree.Root(), excludedLeaf)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	_, err = proof.Verify(New(nil).Root(), excludedLeaf)
+	require.Error(t, err, "Expected error for an untrusted root")
+
+	_, err = prover.ProveNonMembership(included)
+	require.ErrorIs(t, err, ErrIncluded)
+	_, err = prover.ProveNonMembership("not an address")
+	require.Error(t, err)
+}
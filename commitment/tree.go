@@ -0,0 +1,293 @@
+// Package commitment builds Merkle trees over address sets, so that the published root commits to
+// the exact set behind a filter and a server can prove to third parties that an address is in it.
+//
+// Leaves are the AddressHandler.ToBytes outputs of the addresses, sorted and deduplicated. Leaf and
+// node hashes are domain separated as in RFC 6962: H(0x00 || leaf) and H(0x01 || left || right). A
+// node without a sibling is promoted unchanged to the next level.
+package commitment
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// HashSize is the size of the tree hashes.
+const HashSize = sha256.Size
+
+const (
+	treeMagic      = "ZKMT"
+	maxLeafSize    = 1 << 10
+	leafPrefix     = 0x00
+	nodePrefix     = 0x01
+	emptyTreeLabel = "empty tree"
+	maxLeafCount   = 1 << 40
+)
+
+// ErrNotFound is returned when proving the inclusion of a leaf that is not in the tree.
+var ErrNotFound = errors.New("leaf not in tree")
+
+// Tree is an immutable Merkle tree over a sorted set of leaves.
+type Tree struct {
+	leaves [][]byte
+	levels [][]byte // levels[0] holds the leaf hashes, the last level the root; HashSize bytes per node.
+}
+
+// New builds a tree over leaves. The leaves are sorted and deduplicated; the slice is not modified.
+func New(leaves [][]byte) *Tree {
+	sorted := make([][]byte, len(leaves))
+	copy(sorted, leaves)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+
+	unique := sorted[:0]
+	for i, leaf := range sorted {
+		if i == 0 || !bytes.Equal(leaf, sorted[i-1]) {
+			unique = append(unique, leaf)
+		}
+	}
+	return build(unique)
+}
+
+// build builds the tree over leaves that are already sorted and unique.
+func build(leaves [][]byte) *Tree {
+	level := make([]byte, 0, len(leaves)*HashSize)
+	for _, leaf := range leaves {
+		level = append(level, hashLeaf(leaf)...)
+	}
+	return &Tree{leaves: leaves, levels: buildLevels(level)}
+}
+
+// buildLevels hashes the level of leaf hashes up to the root, returning every level.
+func buildLevels(level []byte) [][]byte {
+	levels := [][]byte{level}
+	for len(level) > HashSize {
+		n := len(level) / HashSize
+		next := make([]byte, 0, (n+1)/2*HashSize)
+		for i := 0; i < n; i += 2 {
+			if i+1 < n {
+				next = append(next, hashNode(node(level, i), node(level, i+1))...)
+			} else {
+				next = append(next, node(level, i)...)
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// RootOf returns the root of the tree whose leaves have the given hashes, in the order of the
+// leaves, so that a list of leaf hashes can be checked against a root without the leaves.
+func RootOf(leafHashes [][]byte) ([]byte, error) {
+	if len(leafHashes) == 0 {
+		return (&Tree{}).Root(), nil
+	}
+	level := make([]byte, 0, len(leafHashes)*HashSize)
+	for _, hash := range leafHashes {
+		if len(hash) != HashSize {
+			return nil, errors.New("invalid leaf hash")
+		}
+		level = append(level, hash...)
+	}
+	levels := buildLevels(level)
+	return levels[len(levels)-1], nil
+}
+
+// Root returns the root hash of the tree. The root of an empty tree is a fixed constant.
+func (t *Tree) Root() []byte {
+	if len(t.leaves) == 0 {
+		sum := sha256.Sum256([]byte(emptyTreeLabel))
+		return sum[:]
+	}
+	return t.levels[len(t.levels)-1]
+}
+
+// Len returns the number of leaves.
+func (t *Tree) Len() int {
+	return len(t.leaves)
+}
+
+// Leaf returns the leaf at index i, in sorted order.
+func (t *Tree) Leaf(i int) []byte {
+	return t.leaves[i]
+}
+
+// LeafHash returns the hash of the leaf at index i, in sorted order.
+func (t *Tree) LeafHash(i int) []byte {
+	return node(t.levels[0], i)
+}
+
+// LeafHash returns the hash of leaf in a tree, H(0x00 || leaf).
+func LeafHash(leaf []byte) []byte {
+	return hashLeaf(leaf)
+}
+
+// Search returns the index of leaf and whether it is in the tree. If it is not, the index is
+// where it would be inserted.
+func (t *Tree) Search(leaf []byte) (int, bool) {
+	i := sort.Search(len(t.leaves), func(i int) bool { return bytes.Compare(t.leaves[i], leaf) >= 0 })
+	return i, i < len(t.leaves) && bytes.Equal(t.leaves[i], leaf)
+}
+
+// Prove returns a proof that leaf is in the tree, or ErrNotFound.
+func (t *Tree) Prove(leaf []byte) (*Proof, error) {
+	i, found := t.Search(leaf)
+	if !found {
+		return nil, ErrNotFound
+	}
+	return t.ProveIndex(i)
+}
+
+// ProveIndex returns a proof that the leaf at index i is in the tree.
+func (t *Tree) ProveIndex(i int) (*Proof, error) {
+	if i < 0 || i >= len(t.leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range", i)
+	}
+
+	proof := &Proof{Index: uint64(i), LeafCount: uint64(len(t.leaves))}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		n := len(level) / HashSize
+		if i%2 == 1 {
+			proof.Siblings = append(proof.Siblings, node(level, i-1))
+		} else if i+1 < n {
+			proof.Siblings = append(proof.Siblings, node(level, i+1))
+		}
+		i /= 2
+	}
+	return proof, nil
+}
+
+// Proof proves that a leaf is at a given index of a tree with a given root.
+type Proof struct {
+	Index     uint64   `json:"index"`
+	LeafCount uint64   `json:"leaf_count"`
+	Siblings  [][]byte `json:"siblings"` // Sibling hashes from the leaf level up.
+}
+
+// VerifyInclusion checks that proof proves leaf is in the tree with the given root.
+func VerifyInclusion(root, leaf []byte, proof *Proof) error {
+	if proof == nil {
+		return errors.New("missing proof")
+	}
+	if proof.Index >= proof.LeafCount {
+		return fmt.Errorf("leaf index %d out of range", proof.Index)
+	}
+
+	hash := hashLeaf(leaf)
+	siblings := proof.Siblings
+	for i, n := proof.Index, proof.LeafCount; n > 1; i, n = i/2, (n+1)/2 {
+		if i%2 == 0 && i+1 >= n {
+			continue // promoted without a sibling
+		}
+		if len(siblings) == 0 {
+			return errors.New("proof is too short")
+		}
+		sibling := siblings[0]
+		siblings = siblings[1:]
+		if len(sibling) != HashSize {
+			return errors.New("invalid sibling hash")
+		}
+		if i%2 == 1 {
+			hash = hashNode(sibling, hash)
+		} else {
+			hash = hashNode(hash, sibling)
+		}
+	}
+	if len(siblings) != 0 {
+		return errors.New("proof is too long")
+	}
+	if !bytes.Equal(hash, root) {
+		return errors.New("proof does not match root")
+	}
+	return nil
+}
+
+// WriteTo writes the leaves of the tree to w, from which ReadTree rebuilds it.
+func (t *Tree) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var written int64
+	write := func(data []byte) error {
+		n, err := bw.Write(data)
+		written += int64(n)
+		return err
+	}
+
+	header := make([]byte, len(treeMagic)+8)
+	copy(header, treeMagic)
+	binary.BigEndian.PutUint64(header[len(treeMagic):], uint64(len(t.leaves)))
+	if err := write(header); err != nil {
+		return written, err
+	}
+	for _, leaf := range t.leaves {
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(leaf)))
+		if err := write(length[:]); err != nil {
+			return written, err
+		}
+		if err := write(leaf); err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// ReadTree reads leaves written by WriteTo and rebuilds the tree.
+func ReadTree(r io.Reader) (*Tree, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(treeMagic)+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read tree header: %w", err)
+	}
+	if string(header[:len(treeMagic)]) != treeMagic {
+		return nil, errors.New("not a commitment tree file")
+	}
+	count := binary.BigEndian.Uint64(header[len(treeMagic):])
+	if count > maxLeafCount {
+		return nil, fmt.Errorf("too many leaves: %d", count)
+	}
+
+	var leaves [][]byte
+	var length [2]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(br, length[:]); err != nil {
+			return nil, fmt.Errorf("failed to read leaf: %w", err)
+		}
+		size := binary.BigEndian.Uint16(length[:])
+		if size > maxLeafSize {
+			return nil, fmt.Errorf("leaf too large: %d bytes", size)
+		}
+		leaf := make([]byte, size)
+		if _, err := io.ReadFull(br, leaf); err != nil {
+			return nil, fmt.Errorf("failed to read leaf: %w", err)
+		}
+		if len(leaves) > 0 && bytes.Compare(leaves[len(leaves)-1], leaf) >= 0 {
+			return nil, errors.New("leaves are not sorted")
+		}
+		leaves = append(leaves, leaf)
+	}
+	return build(leaves), nil
+}
+
+func node(level []byte, i int) []byte {
+	return level[i*HashSize : (i+1)*HashSize]
+}
+
+func hashLeaf(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
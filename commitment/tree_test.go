@@ -0,0 +1,110 @@
+package commitment
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("leaf-%05d", i))
+	}
+	return leaves
+}
+
+func TestTreeInclusionProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 7, 8, 13, 100} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			leaves := testLeaves(n)
+			tree := New(leaves)
+			require.Equal(t, n, tree.Len())
+
+			for _, leaf := range leaves {
+				proof, err := tree.Prove(leaf)
+				require.NoError(t, err)
+				require.NoError(t, VerifyInclusion(tree.Root(), leaf, proof))
+			}
+
+			_, err := tree.Prove([]byte("missing"))
+			require.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestTreeRejectsInvalidProofs(t *testing.T) {
+	leaves := testLeaves(10)
+	tree := New(leaves)
+	proof, err := tree.Prove(leaves[3])
+	require.NoError(t, err)
+
+	require.Error(t, VerifyInclusion(tree.Root(), leaves[4], proof), "Expected error for another leaf")
+	require.Error(t, VerifyInclusion(New(leaves[1:]).Root(), leaves[3], proof), "Expected error for another root")
+
+	moved := *proof
+	moved.Index++
+	require.Error(t, VerifyInclusion(tree.Root(), leaves[3], &moved), "Expected error for another index")
+
+	short := *proof
+	short.Siblings = proof.Siblings[1:]
+	require.Error(t, VerifyInclusion(tree.Root(), leaves[3], &short), "Expected error for a truncated proof")
+
+	tampered := *proof
+	tampered.Siblings = append([][]byte{bytes.Repeat([]byte{1}, HashSize)}, proof.Siblings[1:]...)
+	require.Error(t, VerifyInclusion(tree.Root(), leaves[3], &tampered), "Expected error for a tampered sibling")
+}
+
+func TestTreeSortsAndDeduplicates(t *testing.T) {
+	leaves := testLeaves(5)
+	shuffled := [][]byte{leaves[3], leaves[0], leaves[4], leaves[1], leaves[2], leaves[0]}
+	tree := New(shuffled)
+	require.Equal(t, New(leaves).Root(), tree.Root())
+	require.Equal(t, 5, tree.Len())
+	require.Equal(t, leaves[3], shuffled[0], "Expected New not to modify its argument")
+
+	i, found := tree.Search([]byte("leaf-00002x"))
+	require.False(t, found)
+	require.Equal(t, 3, i)
+}
+
+func TestTreeWriteRead(t *testing.T) {
+	tree := New(testLeaves(50))
+	var buf bytes.Buffer
+	_, err := tree.WriteTo(&buf)
+	require.NoError(t, err)
+
+	read, err := ReadTree(&buf)
+	require.NoError(t, err)
+	require.Equal(t, tree.Root(), read.Root())
+
+	empty := New(nil)
+	buf.Reset()
+	_, err = empty.WriteTo(&buf)
+	require.NoError(t, err)
+	read, err = ReadTree(&buf)
+	require.NoError(t, err)
+	require.Equal(t, empty.Root(), read.Root())
+
+	_, err = ReadTree(bytes.NewReader([]byte("not a tree")))
+	require.Error(t, err)
+}
+
+func TestRootOf(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 7, 16} {
+		tree := New(testLeaves(n))
+		hashes := make([][]byte, tree.Len())
+		for i := range hashes {
+			hashes[i] = tree.LeafHash(i)
+			require.Equal(t, LeafHash(tree.Leaf(i)), hashes[i])
+		}
+		root, err := RootOf(hashes)
+		require.NoError(t, err)
+		require.Equal(t, tree.Root(), root, "%d leaves", n)
+	}
+
+	_, err := RootOf([][]byte{[]byte("short")})
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package oprf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	voprf "github.com/cloudflare/circl/oprf"
+	"github.com/cloudflare/circl/zk/dleq"
+)
+
+// Client computes OPRF outputs together with a server without revealing its inputs. It implements
+// store.AddressHasher and store.BatchHasher, so a downloaded filter can be loaded with
+// store.WithAddressHasher(client) and queried locally; every hashed address costs one round trip
+// to the server, and batches of addresses one round trip per MaxBatchSize addresses.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	client     voprf.VerifiableClient
+	keyID      string
+}
+
+// NewClient fetches the server's public key from baseURL and returns a client verifying every
+// evaluation against it. If httpClient is nil, http.DefaultClient is used.
+func NewClient(ctx context.Context, baseURL string, httpClient *http.Client) (*Client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+
+	var key KeyResponse
+	if err := c.do(ctx, http.MethodGet, "/oprf/key", nil, &key); err != nil {
+		return nil, fmt.Errorf("failed to fetch OPRF public key: %w", err)
+	}
+	if key.Suite != Suite.Identifier() {
+		return nil, fmt.Errorf("unsupported OPRF suite %q", key.Suite)
+	}
+	public := new(voprf.PublicKey)
+	if err := public.UnmarshalBinary(Suite, key.PublicKey); err != nil {
+		return nil, fmt.Errorf("invalid OPRF public key: %w", err)
+	}
+
+	c.client = voprf.NewVerifiableClient(Suite, public)
+	c.keyID = publicKeyID(key.PublicKey)
+	return c, nil
+}
+
+// Evaluate returns the OPRF outputs of inputs. The server only sees blinded inputs, and its proof
+// is checked against the public key fetched by NewClient.
+func (c *Client) Evaluate(ctx context.Context, inputs [][]byte) ([][]byte, error) {
+	finalize, request, err := c.client.Blind(inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to blind inputs: %w", err)
+	}
+
+	body := EvaluateRequest{Blinded: make([][]byte, len(request.Elements))}
+	for i, element := range request.Elements {
+		if body.Blinded[i], err = element.MarshalBinaryCompress(); err != nil {
+			return nil, fmt.Errorf("failed to encode blinded element: %w", err)
+		}
+	}
+
+	var response EvaluateResponse
+	if err := c.do(ctx, http.MethodPost, "/oprf/evaluate", body, &response); err != nil {
+		return nil, fmt.Errorf("failed to evaluate: %w", err)
+	}
+	if len(response.Evaluated) != len(inputs) {
+		return nil, fmt.Errorf("server returned %d elements for %d inputs", len(response.Evaluated), len(inputs))
+	}
+
+	evaluation := &voprf.Evaluation{
+		Elements: make([]voprf.Evaluated, len(response.Evaluated)),
+		Proof:    new(dleq.Proof),
+	}
+	for i, data := range response.Evaluated {
+		element := Suite.Group().NewElement()
+		if err := element.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("invalid evaluated element %d: %w", i, err)
+		}
+		evaluation.Elements[i] = element
+	}
+	if err := evaluation.Proof.UnmarshalBinary(Suite.Group(), response.Proof); err != nil {
+		return nil, fmt.Errorf("invalid proof: %w", err)
+	}
+
+	outputs, err := c.client.Finalize(finalize, evaluation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify evaluation: %w", err)
+	}
+	return outputs, nil
+}
+
+// Hash returns the OPRF output of data.
+func (c *Client) Hash(data []byte) ([]byte, error) {
+	outputs, err := c.Evaluate(context.Background(), [][]byte{data})
+	if err != nil {
+		return nil, err
+	}
+	return outputs[0], nil
+}
+
+// HashBatch returns the OPRF outputs of data, evaluated in requests of at most MaxBatchSize inputs.
+func (c *Client) HashBatch(data [][]byte) ([][]byte, error) {
+	outputs := make([][]byte, 0, len(data))
+	for start := 0; start < len(data); start += MaxBatchSize {
+		chunk, err := c.Evaluate(context.Background(), data[start:min(start+MaxBatchSize, len(data))])
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, chunk...)
+	}
+	return outputs, nil
+}
+
+// KeyID returns the id of the server's key, matching the one recorded in filters built with it.
+func (c *Client) KeyID() string {
+	return c.keyID
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,190 @@
+// Package oprf implements an oblivious query protocol for keyed filters. The filter is built over
+// OPRF outputs of the addresses, so it can be distributed publicly: a client computes the OPRF of
+// an address together with the server, which learns neither the address nor the output, and then
+// checks the output against its local copy of the filter.
+//
+// The protocol is the verifiable OPRF from RFC 9497 over P-256; the server proves that every
+// evaluation used the key it published.
+package oprf
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	voprf "github.com/cloudflare/circl/oprf"
+)
+
+// Suite is the OPRF ciphersuite used by servers and clients.
+var Suite = voprf.SuiteP256
+
+// MaxBatchSize bounds the number of elements a client can ask to evaluate in one request.
+const MaxBatchSize = 1000
+
+// Key is the server's OPRF key. It implements store.AddressHasher, so a filter built with
+// store.WithAddressHasher(key) can be queried obliviously.
+type Key struct {
+	private *voprf.PrivateKey
+	server  voprf.VerifiableServer
+	keyID   string
+}
+
+// GenerateKey generates a new random OPRF key.
+func GenerateKey() (*Key, error) {
+	private, err := voprf.GenerateKey(Suite, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate OPRF key: %w", err)
+	}
+	return newKey(private)
+}
+
+// NewKey parses a key serialized with MarshalBinary.
+func NewKey(data []byte) (*Key, error) {
+	if len(data) != int(Suite.Group().Params().ScalarLength) {
+		return nil, fmt.Errorf("invalid OPRF key length %d", len(data))
+	}
+	private := new(voprf.PrivateKey)
+	if err := private.UnmarshalBinary(Suite, data); err != nil {
+		return nil, fmt.Errorf("failed to parse OPRF key: %w", err)
+	}
+	return newKey(private)
+}
+
+func newKey(private *voprf.PrivateKey) (*Key, error) {
+	public, err := private.Public().MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OPRF public key: %w", err)
+	}
+	return &Key{
+		private: private,
+		server:  voprf.NewVerifiableServer(Suite, private),
+		keyID:   publicKeyID(public),
+	}, nil
+}
+
+// MarshalBinary serializes the private key.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	return k.private.MarshalBinary()
+}
+
+// PublicKey returns the serialized public key clients verify evaluations against.
+func (k *Key) PublicKey() ([]byte, error) {
+	return k.private.Public().MarshalBinary()
+}
+
+// Hash returns the OPRF output for data, as computed by a client through the protocol.
+func (k *Key) Hash(data []byte) ([]byte, error) {
+	return k.server.FullEvaluate(data)
+}
+
+// KeyID returns the identifier of the key recorded in filter headers, derived from the public key.
+func (k *Key) KeyID() string {
+	return k.keyID
+}
+
+// Evaluate evaluates blinded elements sent by a client and returns the evaluated elements and a
+// proof that they were computed with this key.
+func (k *Key) Evaluate(blinded [][]byte) ([][]byte, []byte, error) {
+	if len(blinded) == 0 {
+		return nil, nil, errors.New("no elements to evaluate")
+	}
+	if len(blinded) > MaxBatchSize {
+		return nil, nil, fmt.Errorf("too many elements: %d > %d", len(blinded), MaxBatchSize)
+	}
+
+	request := &voprf.EvaluationRequest{Elements: make([]voprf.Blinded, len(blinded))}
+	for i, data := range blinded {
+		element := Suite.Group().NewElement()
+		if err := element.UnmarshalBinary(data); err != nil {
+			return nil, nil, fmt.Errorf("invalid blinded element %d: %w", i, err)
+		}
+		request.Elements[i] = element
+	}
+
+	evaluation, err := k.server.Evaluate(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to evaluate: %w", err)
+	}
+
+	evaluated := make([][]byte, len(evaluation.Elements))
+	for i, element := range evaluation.Elements {
+		if evaluated[i], err = element.MarshalBinaryCompress(); err != nil {
+			return nil, nil, fmt.Errorf("failed to encode evaluated element: %w", err)
+		}
+	}
+	proof, err := evaluation.Proof.MarshalBinary()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode proof: %w", err)
+	}
+	return evaluated, proof, nil
+}
+
+// publicKeyID derives the key id from a serialized public key.
+func publicKeyID(public []byte) string {
+	sum := sha256.Sum256(public)
+	return "oprf-" + hex.EncodeToString(sum[:8])
+}
+
+// KeyResponse is the body returned by PublicKeyHandler.
+type KeyResponse struct {
+	Suite     string `json:"suite"`
+	PublicKey []byte `json:"public_key"`
+	KeyID     string `json:"key_id"`
+}
+
+// EvaluateRequest is the body accepted by EvaluateHandler.
+type EvaluateRequest struct {
+	Blinded [][]byte `json:"blinded"`
+}
+
+// EvaluateResponse is the body returned by EvaluateHandler.
+type EvaluateResponse struct {
+	Evaluated [][]byte `json:"evaluated"`
+	Proof     []byte   `json:"proof"`
+	KeyID     string   `json:"key_id"`
+}
+
+// PublicKeyHandler serves the public key of key, typically on GET /oprf/key.
+func PublicKeyHandler(key *Key) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		public, err := key.PublicKey()
+		if err != nil {
+			http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(KeyResponse{
+			Suite:     Suite.Identifier(),
+			PublicKey: public,
+			KeyID:     key.KeyID(),
+		})
+	})
+}
+
+// EvaluateHandler evaluates blinded elements with key, typically on POST /oprf/evaluate.
+func EvaluateHandler(key *Key) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request EvaluateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, `{"error": "Invalid JSON body"}`, http.StatusBadRequest)
+			return
+		}
+
+		evaluated, proof, err := key.Evaluate(request.Blinded)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid blinded elements"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EvaluateResponse{
+			Evaluated: evaluated,
+			Proof:     proof,
+			KeyID:     key.KeyID(),
+		})
+	})
+}
@@ -0,0 +1,150 @@
+package oprf
+
+import (
+	"addressdb/address"
+	"addressdb/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, key *Key) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/oprf/key", PublicKeyHandler(key))
+	mux.Handle("/oprf/evaluate", EvaluateHandler(key))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func createAddress(t *testing.T) string {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	return crypto.PubkeyToAddress(privateKey.PublicKey).Hex()
+}
+
+func TestOPRFCheckAddress(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	server := newTestServer(t, key)
+	handler := &address.EVMAddressHandler{}
+
+	// The list owner builds the filter over OPRF outputs and publishes it.
+	present, absent := createAddress(t), createAddress(t)
+	owner, err := store.NewBloomFilterStore(handler, store.WithAddressHasher(key))
+	require.NoError(t, err)
+	require.NoError(t, owner.AddAddress(present))
+	filePath := filepath.Join(t.TempDir(), "oprf.gob")
+	require.NoError(t, owner.SaveToFile(filePath))
+
+	// The client loads the published filter and hashes addresses through the server.
+	client, err := NewClient(context.Background(), server.URL, server.Client())
+	require.NoError(t, err)
+	require.Equal(t, key.KeyID(), client.KeyID())
+
+	filter, err := store.NewBloomFilterStoreFromFile(filePath, handler, store.WithAddressHasher(client))
+	require.NoError(t, err)
+	found, err := filter.CheckAddress(present)
+	require.NoError(t, err)
+	require.True(t, found, "Expected address to be found through the OPRF")
+	found, err = filter.CheckAddress(absent)
+	require.NoError(t, err)
+	require.False(t, found, "Expected address not to be found")
+
+	// Outputs computed through the protocol match the ones computed with the key.
+	outputs, err := client.Evaluate(context.Background(), [][]byte{[]byte("a"), []byte("b")})
+	require.NoError(t, err)
+	for i, input := range []string{"a", "b"} {
+		expected, err := key.Hash([]byte(input))
+		require.NoError(t, err)
+		require.Equal(t, expected, outputs[i])
+	}
+
+	// A filter built under another key is rejected by its key id.
+	otherKey, err := GenerateKey()
+	require.NoError(t, err)
+	other := newTestServer(t, otherKey)
+	otherClient, err := NewClient(context.Background(), other.URL, other.Client())
+	require.NoError(t, err)
+	_, err = store.NewBloomFilterStoreFromFile(filePath, handler, store.WithAddressHasher(otherClient))
+	require.Error(t, err, "Expected error when loading a filter built under another key")
+}
+
+func TestOPRFCheckAddresses(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.Handle("/oprf/key", PublicKeyHandler(key))
+	evaluate := EvaluateHandler(key)
+	mux.HandleFunc("/oprf/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		evaluate.ServeHTTP(w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	handler := &address.EVMAddressHandler{}
+
+	addresses := make([]string, MaxBatchSize+1)
+	for i := range addresses {
+		addresses[i] = createAddress(t)
+	}
+	owner, err := store.NewBloomFilterStore(handler, store.WithAddressHasher(key))
+	require.NoError(t, err)
+	require.Nil(t, owner.AddAddresses(addresses[:10]))
+	filePath := filepath.Join(t.TempDir(), "oprf.gob")
+	require.NoError(t, owner.SaveToFile(filePath))
+
+	client, err := NewClient(context.Background(), server.URL, server.Client())
+	require.NoError(t, err)
+	filter, err := store.NewBloomFilterStoreFromFile(filePath, handler, store.WithAddressHasher(client))
+	require.NoError(t, err)
+
+	// The batch is hashed in requests of MaxBatchSize addresses; invalid ones are not sent.
+	results := filter.CheckAddresses(append(addresses, "invalid"))
+	require.Equal(t, int32(2), requests.Load())
+	for i, result := range results[:len(addresses)] {
+		require.NoError(t, result.Err)
+		require.Equal(t, i < 10, result.Found(), "Unexpected result for address %d", i)
+	}
+	require.Error(t, results[len(addresses)].Err)
+}
+
+func TestOPRFKeyRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	data, err := key.MarshalBinary()
+	require.NoError(t, err)
+
+	parsed, err := NewKey(data)
+	require.NoError(t, err)
+	require.Equal(t, key.KeyID(), parsed.KeyID())
+
+	expected, err := key.Hash([]byte("address"))
+	require.NoError(t, err)
+	got, err := parsed.Hash([]byte("address"))
+	require.NoError(t, err)
+	require.Equal(t, expected, got)
+
+	_, err = NewKey([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestOPRFEvaluateRejectsInvalidElements(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	_, _, err = key.Evaluate(nil)
+	require.Error(t, err)
+	_, _, err = key.Evaluate([][]byte{[]byte("not a point")})
+	require.Error(t, err)
+	_, _, err = key.Evaluate(make([][]byte, MaxBatchSize+1))
+	require.Error(t, err)
+
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"path/filepath"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -31,12 +32,14 @@ func NewFileWatcherNotifier(filePath string, reloadDelay time.Duration) (*FileWa
 }
 
 // WatchForChange monitors the file for changes and triggers the onReload callback when necessary.
-// It blocks until the context is canceled or an error occurs.
+// It watches the parent directory so the file may be created, or renamed into place, after
+// watching starts. It blocks until the context is canceled or an error occurs.
 func (fw *FileWatcherNotifier) WatchForChange(ctx context.Context, onReload func(filePath string) error) error {
-	err := fw.watcher.Add(fw.filePath)
+	err := fw.watcher.Add(filepath.Dir(fw.filePath))
 	if err != nil {
 		return fmt.Errorf("failed to add file to watcher: %v", err)
 	}
+	target := filepath.Clean(fw.filePath)
 
 	debounceTimer := time.NewTimer(0)
 	if !debounceTimer.Stop() {
@@ -49,7 +52,10 @@ func (fw *FileWatcherNotifier) WatchForChange(ctx context.Context, onReload func
 			if !ok {
 				return nil // Channel closed, stop the watcher
 			}
-			if event.Op&fsnotify.Write == fsnotify.Write {
+			if filepath.Clean(event.Name) != target {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
 				log.Printf("File change detected: %s", fw.filePath)
 				debounceTimer.Reset(fw.reloadDelay)
 			}
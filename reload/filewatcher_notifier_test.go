@@ -1,8 +1,11 @@
 package reload
 
 import (
+	"addressdb/address"
+	"addressdb/store"
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -35,14 +38,10 @@ func TestWatchForChange(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 
-	// Variables to track reload success and the filePath passed
-	reloadSuccessful := false
-	var receivedFilePath string
-
-	// Mock the onReload function
+	// Mock the onReload function, passing the received filePath back to the test
+	reloaded := make(chan string, 1)
 	onReload := func(filePath string) error {
-		reloadSuccessful = true     // Mark reload as successful
-		receivedFilePath = filePath // Capture the received filePath
+		reloaded <- filePath
 		return nil
 	}
 
@@ -54,14 +53,50 @@ func TestWatchForChange(t *testing.T) {
 	// Simulate a file change event
 	notifier.watcher.Events <- fsnotify.Event{Op: fsnotify.Write, Name: filePath}
 
-	// Wait for a bit to allow the reload to be triggered
-	time.Sleep(150 * time.Millisecond)
-
-	// Assert that the reload was successful
-	assert.True(t, reloadSuccessful, "Expected reload to be successful")
-	// Assert that the correct filePath was passed to the onReload function
-	assert.Equal(t, filePath, receivedFilePath, "Expected filePath to match")
+	// Wait for the reload to be triggered
+	select {
+	case receivedFilePath := <-reloaded:
+		// Assert that the correct filePath was passed to the onReload function
+		assert.Equal(t, filePath, receivedFilePath, "Expected filePath to match")
+	case <-ctx.Done():
+		t.Fatal("Expected reload to be successful")
+	}
 
 	// Clean up
 	_ = notifier.Close()
 }
+
+// TestWatchForChangeAtomicSave tests that files replaced by a rename, as SaveToFile does, are reloaded.
+func TestWatchForChangeAtomicSave(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	bf, err := store.NewBloomFilterStore(&address.EVMAddressHandler{}, store.WithEstimates(1000, 0.001))
+	assert.NoError(t, err)
+	assert.NoError(t, bf.SaveToFile(filePath))
+
+	notifier, err := NewFileWatcherNotifier(filePath, 50*time.Millisecond)
+	assert.NoError(t, err)
+	defer notifier.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	reloaded := make(chan string, 10)
+	go func() {
+		_ = notifier.WatchForChange(ctx, func(filePath string) error {
+			reloaded <- filePath
+			return nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, bf.SaveToFile(filePath))
+	select {
+	case got := <-reloaded:
+		assert.Equal(t, filePath, got)
+	case <-ctx.Done():
+		t.Fatal("Expected a reload after the file was replaced")
+	}
+
+	// The file can be reloaded once the reload is triggered.
+	_, err = store.NewBloomFilterStoreFromFile(filePath, &address.EVMAddressHandler{})
+	assert.NoError(t, err)
+}
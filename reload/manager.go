@@ -34,6 +34,14 @@ func (m *ReloadManager) Start(ctx context.Context) error {
 	m.eg.Go(func() error {
 		// Pass a reload callback to the notifier.
 		return m.notifier.WatchForChange(m.ctx, func(filePath string) error {
+			isDelta, err := store.IsDeltaFile(filePath)
+			if err != nil {
+				return err
+			}
+			if isDelta {
+				log.Println("Applying Bloom filter delta due to notification.")
+				return m.store.ApplyDeltaFile(filePath) // Apply the delta in place.
+			}
 			log.Println("Reloading Bloom filter due to notification.")
 			return m.store.LoadFromFile(filePath) // Reload the Bloom filter.
 		})
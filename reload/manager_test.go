@@ -5,7 +5,6 @@ import (
 	"context"
 	"os"
 	"testing"
-	"time"
 
 	"addressdb/store"
 	"github.com/stretchr/testify/assert"
@@ -28,7 +27,7 @@ func (m *MockNotifier) Close() error {
 
 func setupTest(t *testing.T) (*store.BloomFilterStore, *MockNotifier, string) {
 	addressHandler := &address.EVMAddressHandler{}
-	generator, _ := store.NewBloomFilterStore(1000, 0.001, addressHandler)
+	generator, _ := store.NewBloomFilterStore(addressHandler, store.WithEstimates(1000, 0.001))
 	filePath := os.TempDir() + "/testfile.gob"
 	generator.SaveToFile(filePath)
 	return generator, new(MockNotifier), filePath
@@ -41,19 +40,20 @@ func TestReloadManager_Start(t *testing.T) {
 	address1 := "0x1234567890abcdef1234567890abcdef12345678"
 	address2 := "0xabcdef1234567890abcdef1234567890abcdef12"
 	generator.AddAddress(address1)
+	generator.SaveToFile(filePath)
 
 	store, _ := store.NewBloomFilterStoreFromFile(filePath, &address.EVMAddressHandler{})
 	manager := NewReloadManager(store, notifier)
 
-	var reloadFunc func(string) error
+	reloadFuncs := make(chan func(string) error, 1)
 	notifier.On("WatchForChange", mock.Anything, mock.Anything).
 		Run(func(args mock.Arguments) {
-			reloadFunc = args.Get(1).(func(string) error)
+			reloadFuncs <- args.Get(1).(func(string) error)
 		}).Return(nil).Once()
 
 	err := manager.Start(context.Background())
 	assert.NoError(t, err)
-	time.Sleep(150 * time.Millisecond)
+	reloadFunc := <-reloadFuncs
 
 	assertAddressCheck(t, store, address1, true)
 	assertAddressCheck(t, store, address2, false)
@@ -90,3 +90,36 @@ func TestReloadManager_Stop(t *testing.T) {
 
 	notifier.AssertExpectations(t)
 }
+
+func TestReloadManager_ApplyDelta(t *testing.T) {
+	generator, notifier, filePath := setupTest(t)
+	defer os.Remove(filePath)
+
+	address1 := "0x1234567890abcdef1234567890abcdef12345678"
+	generator.AddAddress(address1)
+	targetPath := os.TempDir() + "/testfile-target.gob"
+	generator.SaveToFile(targetPath)
+	defer os.Remove(targetPath)
+
+	from, _ := store.NewBloomFilterStoreFromFile(filePath, &address.EVMAddressHandler{})
+	to, _ := store.NewBloomFilterStoreFromFile(targetPath, &address.EVMAddressHandler{})
+	deltaPath := store.DeltaPath(filePath)
+	assert.NoError(t, store.WriteDeltaFile(deltaPath, from, to, nil))
+	defer os.Remove(deltaPath)
+
+	manager := NewReloadManager(from, notifier)
+	reloadFuncs := make(chan func(string) error, 1)
+	notifier.On("WatchForChange", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			reloadFuncs <- args.Get(1).(func(string) error)
+		}).Return(nil).Once()
+
+	assert.NoError(t, manager.Start(context.Background()))
+	reloadFunc := <-reloadFuncs
+
+	assertAddressCheck(t, from, address1, false)
+	assert.NoError(t, reloadFunc(deltaPath))
+	assertAddressCheck(t, from, address1, true)
+
+	notifier.AssertExpectations(t)
+}
@@ -113,28 +113,41 @@ func (h *OpenPGPSecureHandler) Reader(input io.Reader) (VerifyDataReader, error)
 
 // VerifiedReader wraps VerifyDataReader and verifies the signature at the end.
 type VerifiedReader struct {
-	reader *crypto.VerifyDataReader
+	reader   *crypto.VerifyDataReader
+	verified bool  // The signature was verified on reaching the end of the data.
+	err      error // Result of the verification.
 }
 
 // Read reads data from the underlying VerifyDataReader and verifies the signature at the end.
 func (r *VerifiedReader) Read(b []byte) (int, error) {
 	n, err := r.reader.Read(b)
 	if errors.Is(err, io.EOF) {
-		if result, verifyErr := r.reader.VerifySignature(); verifyErr != nil {
-			return n, verifyErr
-		} else if result.SignatureError() != nil {
-			return n, result.SignatureError()
+		if !r.verified {
+			r.verified = true
+			if result, verifyErr := r.reader.VerifySignature(); verifyErr != nil {
+				r.err = verifyErr
+			} else {
+				r.err = result.SignatureError()
+			}
+		}
+		if r.err != nil {
+			return n, r.err
 		}
 	}
 	return n, err
 }
 
+// VerifySignature reads the rest of the data and verifies the signature, or returns the result of
+// the verification done by Read if it reached the end of the data.
 func (r *VerifiedReader) VerifySignature() error {
+	if r.verified {
+		return r.err
+	}
+	r.verified = true
 	if result, err := r.reader.ReadAllAndVerifySignature(); err != nil {
-		return err
+		r.err = err
 	} else if result.SignatureError() != nil {
-		return result.SignatureError()
+		r.err = result.SignatureError()
 	}
-
-	return nil
+	return r.err
 }
@@ -188,3 +188,27 @@ func readData(t *testing.T, reader io.Reader) []byte {
 	require.NoError(t, err)
 	return data
 }
+
+func TestSecret(t *testing.T) {
+	keys := GenerateTestKeys(t)
+	aliceKeyPriv, aliceKeyPub := keys[0], keys[1]
+	bobKeyPriv, bobKeyPub := keys[2], keys[3]
+	chadKeyPriv := keys[4]
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	var buf bytes.Buffer
+	require.NoError(t, WriteSecret(createHandler(t, aliceKeyPriv, bobKeyPub), &buf, secret))
+	encrypted := buf.Bytes()
+
+	got, err := ReadSecret(createHandler(t, bobKeyPriv, aliceKeyPub), bytes.NewReader(encrypted))
+	require.NoError(t, err)
+	require.Equal(t, secret, got)
+
+	_, err = ReadSecret(createHandler(t, chadKeyPriv, aliceKeyPub), bytes.NewReader(encrypted))
+	require.Error(t, err, "Chad should not be able to read Bob's secret")
+
+	buf.Reset()
+	require.NoError(t, WriteSecret(createHandler(t, chadKeyPriv, bobKeyPub), &buf, secret))
+	_, err = ReadSecret(createHandler(t, bobKeyPriv, aliceKeyPub), &buf)
+	require.Error(t, err, "Chad should not be able to impersonate Alice")
+}
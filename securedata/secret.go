@@ -0,0 +1,40 @@
+package securedata
+
+import (
+	"errors"
+	"io"
+)
+
+// maxSecretSize bounds the size of secrets read by ReadSecret.
+const maxSecretSize = 1 << 16
+
+// WriteSecret encrypts and signs a secret, such as a filter hashing key, to output.
+func WriteSecret(handler SecureDataHandler, output io.Writer, secret []byte) error {
+	w, err := handler.Writer(output)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(secret); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// ReadSecret decrypts a secret written by WriteSecret and verifies its signature.
+func ReadSecret(handler SecureDataHandler, input io.Reader) ([]byte, error) {
+	r, err := handler.Reader(input)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := io.ReadAll(io.LimitReader(r, maxSecretSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) > maxSecretSize {
+		return nil, errors.New("secret too large")
+	}
+	if err := r.VerifySignature(); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,269 @@
+package store
+
+import (
+	"addressdb/securedata"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	addressInfoMagic  = "ZKAI"
+	maxAddressInfoLen = 1 << 16
+)
+
+// AddressInfo describes why an address is in a list.
+type AddressInfo struct {
+	Category  string    `json:"category"`
+	Source    string    `json:"source"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// MarshalJSON omits first_seen when it is unknown.
+func (i AddressInfo) MarshalJSON() ([]byte, error) {
+	type plain AddressInfo
+	encoded := struct {
+		plain
+		FirstSeen *time.Time `json:"first_seen,omitempty"`
+	}{plain: plain(i)}
+	if !i.FirstSeen.IsZero() {
+		encoded.FirstSeen = &i.FirstSeen
+	}
+	return json.Marshal(encoded)
+}
+
+// addressInfoSet maps the ToBytes outputs of addresses to their AddressInfo entries.
+type addressInfoSet map[string][]AddressInfo
+
+// add records info for key, unless an identical entry exists.
+func (s addressInfoSet) add(key []byte, info AddressInfo) {
+	for _, existing := range s[string(key)] {
+		if existing.Category == info.Category && existing.Source == info.Source && existing.FirstSeen.Equal(info.FirstSeen) {
+			return
+		}
+	}
+	s[string(key)] = append(s[string(key)], info)
+}
+
+// WithAddressInfo makes the store keep AddressInfo entries for its addresses, added with
+// AddAddressInfo and returned by LookupAddress. They are saved next to the filter file, see
+// AddressInfoPath, and loaded with it if its header says it has some.
+func WithAddressInfo() Option {
+	return func(bf *BloomFilterStore) {
+		bf.building().info = make(addressInfoSet)
+	}
+}
+
+// AddressInfoPath returns the path of the address info written next to the filter file filePath.
+func AddressInfoPath(filePath string) string {
+	return filePath + ".info"
+}
+
+// AddAddressInfo records info about an address. It does not add the address to the filter.
+func (bf *BloomFilterStore) AddAddressInfo(address string, info AddressInfo) error {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
+		return err
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if bf.current.Load().info == nil {
+		return errors.New("store has no address info, see WithAddressInfo")
+	}
+	s, err := bf.writable()
+	if err != nil {
+		return err
+	}
+	s.info.add(addressBytes, info)
+	return nil
+}
+
+// LookupAddress checks an address and, if it is in the filter, returns the info recorded about it.
+// It returns nil if the address is not in the filter or has no info.
+func (bf *BloomFilterStore) LookupAddress(address string) ([]AddressInfo, error) {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
+		return nil, err
+	}
+	key, err := bf.hashAddress(addressBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+	if s.match(key) == NotPresent {
+		return nil, nil
+	}
+	return s.info[string(addressBytes)], nil
+}
+
+// writeAddressInfo writes the address info to filePath: the magic and the checksum of the filter
+// file it belongs to, followed by the entries, encrypted if a SecureDataHandler is configured. The
+// replaced file is kept at backupPath unless it is empty. s is the snapshot saved in the filter file.
+func (bf *BloomFilterStore) writeAddressInfo(filePath, backupPath string, s *snapshot) error {
+	checksum, err := hex.DecodeString(s.metadata.Checksum)
+	if err != nil {
+		return err
+	}
+
+	f, err := createAtomic(filePath, backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to create address info file: %w", err)
+	}
+	defer f.Abort()
+
+	w := bufio.NewWriter(f)
+	w.WriteString(addressInfoMagic)
+	w.Write(checksum)
+
+	var body io.WriteCloser = nopWriteCloser{w}
+	if bf.secureDataHandler != nil {
+		if body, err = bf.secureDataHandler.Writer(w); err != nil {
+			return fmt.Errorf("failed to encrypt address info: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint64(len(s.info)))
+	for key, entries := range s.info {
+		writeBytes(&buf, []byte(key))
+		binary.Write(&buf, binary.BigEndian, uint16(len(entries)))
+		for _, info := range entries {
+			writeBytes(&buf, []byte(info.Category))
+			writeBytes(&buf, []byte(info.Source))
+			var firstSeen int64
+			if !info.FirstSeen.IsZero() {
+				firstSeen = info.FirstSeen.Unix()
+			}
+			binary.Write(&buf, binary.BigEndian, firstSeen)
+		}
+		if buf.Len() > 1<<16 {
+			if _, err := body.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+	}
+	if _, err := body.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// readAddressInfo reads the address info written next to a filter file whose checksum is checksum.
+func (bf *BloomFilterStore) readAddressInfo(filePath string, checksum string) (addressInfoSet, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open address info: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header := make([]byte, len(addressInfoMagic)+sha256.Size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read address info: %w", err)
+	}
+	if string(header[:len(addressInfoMagic)]) != addressInfoMagic {
+		return nil, fmt.Errorf("not an address info file")
+	}
+	if hex.EncodeToString(header[len(addressInfoMagic):]) != checksum {
+		return nil, fmt.Errorf("address info does not belong to the filter file")
+	}
+
+	var body io.Reader = r
+	var verifier securedata.VerifyDataReader
+	if bf.secureDataHandler != nil {
+		if verifier, err = bf.secureDataHandler.Reader(r); err != nil {
+			return nil, fmt.Errorf("failed to decrypt address info: %w", err)
+		}
+		body = verifier
+	}
+
+	info, err := readAddressInfoEntries(bufio.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read address info: %w", err)
+	}
+	if verifier != nil {
+		if err := verifier.VerifySignature(); err != nil {
+			return nil, fmt.Errorf("failed to verify address info signature: %w", err)
+		}
+	}
+	return info, nil
+}
+
+func readAddressInfoEntries(r io.Reader) (addressInfoSet, error) {
+	var count uint64
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+
+	info := make(addressInfoSet, min(count, 1<<20))
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		entries := make([]AddressInfo, n)
+		for j := range entries {
+			category, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			source, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			var firstSeen int64
+			if err := binary.Read(r, binary.BigEndian, &firstSeen); err != nil {
+				return nil, err
+			}
+			entries[j] = AddressInfo{Category: string(category), Source: string(source)}
+			if firstSeen != 0 {
+				entries[j].FirstSeen = time.Unix(firstSeen, 0).UTC()
+			}
+		}
+		info[string(key)] = entries
+	}
+	return info, nil
+}
+
+// writeBytes writes data prefixed with its uint16 length, truncating it to the maximum length.
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	if len(data) >= maxAddressInfoLen {
+		data = data[:maxAddressInfoLen-1]
+	}
+	binary.Write(buf, binary.BigEndian, uint16(len(data)))
+	buf.Write(data)
+}
+
+func readBytes(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressInfo(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	bf, err := NewBloomFilterStore(addressHandler, WithAddressInfo(), WithSecureDataHandler(aliceWriter))
+	require.NoError(t, err)
+	flagged, unannotated, clean := createAddress(), createAddress(), createAddress()
+	addAddressesToBloomFilter(t, bf, []string{flagged, unannotated})
+	firstSeen := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	sanctions := AddressInfo{Category: "sanctions", Source: "ofac", FirstSeen: firstSeen}
+	mixer := AddressInfo{Category: "mixer", Source: "internal"}
+	require.NoError(t, bf.AddAddressInfo(flagged, sanctions))
+	require.NoError(t, bf.AddAddressInfo(flagged, mixer))
+	require.NoError(t, bf.AddAddressInfo(flagged, sanctions))
+
+	filePath := os.TempDir() + "/bloomfilter-info.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	defer os.Remove(filePath)
+	defer os.Remove(AddressInfoPath(filePath))
+
+	loaded := mustLoad(t, filePath, addressHandler, WithAddressInfo(), WithSecureDataHandler(bobReader))
+	for _, store := range []*BloomFilterStore{bf, loaded} {
+		info, err := store.LookupAddress(flagged)
+		require.NoError(t, err)
+		require.Equal(t, []AddressInfo{sanctions, mixer}, info)
+
+		info, err = store.LookupAddress(unannotated)
+		require.NoError(t, err)
+		require.Empty(t, info)
+
+		info, err = store.LookupAddress(clean)
+		require.NoError(t, err)
+		require.Nil(t, info)
+	}
+
+	// Info signed by another key is rejected.
+	chadWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[4]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	impostor, err := NewBloomFilterStore(addressHandler, WithAddressInfo(), WithSecureDataHandler(chadWriter))
+	require.NoError(t, err)
+	require.NoError(t, impostor.writeAddressInfo(AddressInfoPath(filePath), "", bf.current.Load()))
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler, WithAddressInfo(), WithSecureDataHandler(bobReader))
+	require.Error(t, err)
+
+	// Info written for another version of the filter is rejected.
+	other, err := NewBloomFilterStore(addressHandler, WithAddressInfo(), WithSecureDataHandler(aliceWriter))
+	require.NoError(t, err)
+	otherPath := os.TempDir() + "/bloomfilter-info-other.gob"
+	require.NoError(t, other.SaveToFile(otherPath))
+	defer os.Remove(otherPath)
+	require.NoError(t, os.Rename(AddressInfoPath(otherPath), AddressInfoPath(filePath)))
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler, WithAddressInfo(), WithSecureDataHandler(bobReader))
+	require.Error(t, err)
+
+	// Stores without WithAddressInfo ignore the info file.
+	plain := mustLoad(t, filePath, addressHandler, WithSecureDataHandler(bobReader))
+	require.Error(t, plain.AddAddressInfo(flagged, sanctions))
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WithBackup makes SaveToFile keep the file it replaces, see BackupPath. Files written next to it,
+// such as the commitment and address info, are kept next to the backup.
+func WithBackup() Option {
+	return func(bf *BloomFilterStore) {
+		bf.backup = true
+	}
+}
+
+// BackupPath returns the path the previous version of filePath is kept at when saving with WithBackup.
+func BackupPath(filePath string) string {
+	return filePath + ".bak"
+}
+
+// atomicFile is a temporary file in the directory of its target, renamed over the target by Commit
+// so that readers see either the previous or the complete new file.
+type atomicFile struct {
+	*os.File
+	path       string
+	backupPath string // Path the replaced file is kept at, or empty.
+	done       bool
+}
+
+// createAtomic creates a temporary file that replaces filePath on Commit. If backupPath is not
+// empty, the file being replaced is kept there.
+func createAtomic(filePath, backupPath string) (*atomicFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: filePath, backupPath: backupPath}, nil
+}
+
+// Commit flushes the file to disk and renames it over its target.
+func (f *atomicFile) Commit() error {
+	if f.done {
+		return errors.New("file already committed or aborted")
+	}
+	f.done = true
+	if err := f.Sync(); err != nil {
+		f.File.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if f.backupPath != "" {
+		if err := backupFile(f.path, f.backupPath); err != nil {
+			os.Remove(f.Name())
+			return fmt.Errorf("failed to back up %s: %w", f.path, err)
+		}
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// Abort removes the temporary file, unless it was committed.
+func (f *atomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// backupFile makes backupPath a copy of filePath, if it exists. It hard links the file when
+// possible, so the backup costs no space until the file is replaced.
+func backupFile(filePath, backupPath string) error {
+	if err := os.Remove(backupPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err := os.Link(filePath, backupPath)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := createAtomic(backupPath, "")
+	if err != nil {
+		return err
+	}
+	defer dst.Abort()
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Commit()
+}
+
+// syncDir flushes the directory entry of a renamed file to disk. Errors are ignored, as not every
+// platform supports syncing directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
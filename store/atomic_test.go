@@ -0,0 +1,81 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveToFileBackup(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	first, second := createAddress(), createAddress()
+
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithAddressInfo(), WithBackup())
+	require.NoError(t, err)
+	require.NoError(t, bf.AddAddress(first))
+	require.NoError(t, bf.AddAddressInfo(first, AddressInfo{Category: "first"}))
+	require.NoError(t, bf.SaveToFile(filePath))
+	_, err = os.Stat(BackupPath(filePath))
+	require.ErrorIs(t, err, os.ErrNotExist, "nothing to back up on the first save")
+
+	require.NoError(t, bf.AddAddress(second))
+	require.NoError(t, bf.AddAddressInfo(second, AddressInfo{Category: "second"}))
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	current := mustLoad(t, filePath, addressHandler, WithAddressInfo())
+	checkAddressesInBloomFilter(t, current, []string{first, second})
+
+	previous := mustLoad(t, BackupPath(filePath), addressHandler, WithAddressInfo())
+	found, err := previous.CheckAddress(second)
+	require.NoError(t, err)
+	require.False(t, found)
+	info, err := previous.LookupAddress(first)
+	require.NoError(t, err)
+	require.Equal(t, []AddressInfo{{Category: "first"}}, info)
+
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"bloomfilter.gob", "bloomfilter.gob.info", "bloomfilter.gob.bak", "bloomfilter.gob.bak.info"}, names)
+}
+
+func TestSaveToFileKeepsPreviousOnError(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	address := createAddress()
+
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	require.NoError(t, bf.AddAddress(address))
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	bf.secureDataHandler = failingHandler{}
+	require.Error(t, bf.SaveToFile(filePath))
+
+	checkAddressesInBloomFilter(t, mustLoad(t, filePath, addressHandler), []string{address})
+	entries, err := os.ReadDir(filepath.Dir(filePath))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+// failingHandler is a SecureDataHandler that fails to encrypt.
+type failingHandler struct{}
+
+func (failingHandler) Writer(io.Writer) (io.WriteCloser, error) {
+	return nil, errors.New("encryption failed")
+}
+
+func (failingHandler) Reader(io.Reader) (securedata.VerifyDataReader, error) {
+	return nil, errors.New("decryption failed")
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// minBatchChunk is the smallest number of addresses handed to a worker by the batch methods, below
+// which starting goroutines costs more than validating and hashing the addresses.
+const minBatchChunk = 256
+
+// Result is the outcome of checking one address with CheckAddresses.
+type Result struct {
+	Match Match
+	Err   error // Set if the address is invalid, Match is NotPresent then.
+}
+
+// Found reports whether the address possibly is in the store.
+func (r Result) Found() bool {
+	return r.Err == nil && r.Match != NotPresent
+}
+
+// AddAddresses inserts addresses into the filter like AddAddress. The addresses are validated and
+// hashed in parallel, then inserted in order under a single lock. It returns nil if every address
+// was added, and otherwise the error of each address, nil for the ones that were added.
+func (bf *BloomFilterStore) AddAddresses(addresses []string) []error {
+	addressBytes, keys, errs := bf.addressKeys(addresses)
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	err := bf.expire()
+	var s *snapshot
+	if err == nil {
+		s, err = bf.writable()
+	}
+	failed := false
+	for i := range addresses {
+		if errs[i] == nil {
+			if errs[i] = err; err == nil {
+				errs[i] = bf.add(s, addressBytes[i], keys[i])
+			}
+		}
+		failed = failed || errs[i] != nil
+	}
+	if !failed {
+		return nil
+	}
+	return errs
+}
+
+// CheckAddresses checks addresses like MatchAddress, validating, hashing and testing them in
+// parallel against a single snapshot of the filter. The results are in the order of addresses.
+func (bf *BloomFilterStore) CheckAddresses(addresses []string) []Result {
+	_, keys, errs := bf.addressKeys(addresses)
+
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+
+	results := make([]Result, len(addresses))
+	forEach(len(addresses), func(i int) {
+		if results[i].Err = errs[i]; errs[i] == nil {
+			results[i].Match = s.match(keys[i])
+		}
+	})
+	return results
+}
+
+// addressKeys validates addresses and converts them to bytes in parallel, then hashes them, in one
+// batch if the store's AddressHasher is a BatchHasher. It returns the bytes, key and error of each
+// address.
+func (bf *BloomFilterStore) addressKeys(addresses []string) (addressBytes, keys [][]byte, errs []error) {
+	addressBytes = make([][]byte, len(addresses))
+	keys = make([][]byte, len(addresses))
+	errs = make([]error, len(addresses))
+	_, batch := bf.hasher.(BatchHasher)
+	forEach(len(addresses), func(i int) {
+		if addressBytes[i], errs[i] = bf.addressBytes(addresses[i]); errs[i] == nil && !batch {
+			keys[i], errs[i] = bf.hashAddress(addressBytes[i])
+		}
+	})
+	if !batch {
+		return addressBytes, keys, errs
+	}
+
+	var valid []int
+	var inputs [][]byte
+	for i, err := range errs {
+		if err == nil {
+			valid = append(valid, i)
+			inputs = append(inputs, addressBytes[i])
+		}
+	}
+	if len(inputs) == 0 {
+		return addressBytes, keys, errs
+	}
+	hashed, err := bf.hashAll(inputs)
+	for j, i := range valid {
+		if err != nil {
+			errs[i] = err
+		} else {
+			keys[i] = hashed[j]
+		}
+	}
+	return addressBytes, keys, errs
+}
+
+// hashAll hashes address bytes like hashAddress, in one batch if the store's AddressHasher is a
+// BatchHasher.
+func (bf *BloomFilterStore) hashAll(addressBytes [][]byte) ([][]byte, error) {
+	if batcher, ok := bf.hasher.(BatchHasher); ok {
+		hashed, err := batcher.HashBatch(addressBytes)
+		if err == nil && len(hashed) != len(addressBytes) {
+			err = fmt.Errorf("hasher returned %d hashes for %d addresses", len(hashed), len(addressBytes))
+		}
+		return hashed, err
+	}
+	keys := make([][]byte, len(addressBytes))
+	for i := range addressBytes {
+		var err error
+		if keys[i], err = bf.hashAddress(addressBytes[i]); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// forEach calls fn with every index below n, splitting them into chunks run by up to GOMAXPROCS
+// goroutines. Each index is passed to fn once, so fn can write to its own slice elements.
+func forEach(n int, fn func(i int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if chunks := (n + minBatchChunk - 1) / minBatchChunk; chunks < workers {
+		workers = chunks
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	size := (n + workers - 1) / workers
+	for start := 0; start < n; start += size {
+		end := min(start+size, n)
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				fn(i)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
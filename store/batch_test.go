@@ -0,0 +1,51 @@
+package store
+
+import (
+	"addressdb/address"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAddressesCheckAddresses(t *testing.T) {
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{}, WithEstimates(2000, 0.0001), WithExactMatch())
+	require.NoError(t, err)
+
+	// Enough addresses to be split among several workers.
+	added := make([]string, 1000)
+	for i := range added {
+		added[i] = createAddress()
+	}
+	require.Nil(t, bf.AddAddresses(added))
+	require.Equal(t, uint64(len(added)), bf.Metadata().ElementCount)
+
+	errs := bf.AddAddresses([]string{createAddress(), "not an address"})
+	require.Len(t, errs, 2)
+	require.NoError(t, errs[0])
+	require.Error(t, errs[1])
+	require.Equal(t, uint64(len(added)+1), bf.Metadata().ElementCount)
+
+	missing := createAddress()
+	results := bf.CheckAddresses(append(added, missing, "not an address"))
+	require.Len(t, results, len(added)+2)
+	for i := range added {
+		require.NoError(t, results[i].Err)
+		require.Equal(t, Present, results[i].Match)
+		require.True(t, results[i].Found())
+	}
+	require.False(t, results[len(added)].Found())
+	require.NoError(t, results[len(added)].Err)
+	require.Error(t, results[len(added)+1].Err)
+	require.False(t, results[len(added)+1].Found())
+
+	// Batches work the same against a loaded, immutable snapshot, and writes copy it first.
+	filePath := t.TempDir() + "/bloomfilter.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	loaded, err := NewBloomFilterStoreFromFile(filePath, &address.EVMAddressHandler{})
+	require.NoError(t, err)
+	for _, result := range loaded.CheckAddresses(added) {
+		require.True(t, result.Found())
+	}
+	require.Nil(t, loaded.AddAddresses([]string{missing}))
+	require.True(t, loaded.CheckAddresses([]string{missing})[0].Found())
+}
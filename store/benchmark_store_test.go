@@ -105,3 +105,53 @@ func BenchmarkBloomFilterNaiveCheck(b *testing.B) {
 		bf.TestString(strings.ToLower(address))
 	}
 }
+
+// BenchmarkCheckAddressParallel compares parallel checks against a store being built, whose reads
+// take the read lock, and against a loaded store, whose reads use its snapshot without locking.
+func BenchmarkCheckAddressParallel(b *testing.B) {
+	addressHandler := &address.EVMAddressHandler{}
+	count := 100000
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(uint(count), 0.000001))
+	if err != nil {
+		b.Fatalf("Failed to create BloomFilterStore: %v", err)
+	}
+
+	addresses := make([]string, count)
+	for i := 0; i < count; i++ {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		addresses[i] = crypto.PubkeyToAddress(key.PublicKey).Hex()
+		if rand.Intn(2) < 1 {
+			bf.AddAddress(addresses[i])
+		}
+	}
+
+	filePath := b.TempDir() + "/bloomfilter.gob"
+	if err := bf.SaveToFile(filePath); err != nil {
+		b.Fatalf("Failed to save BloomFilterStore: %v", err)
+	}
+	loaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler)
+	if err != nil {
+		b.Fatalf("Failed to load BloomFilterStore: %v", err)
+	}
+
+	for _, bc := range []struct {
+		name  string
+		store *BloomFilterStore
+	}{
+		{"locked", bf},
+		{"snapshot", loaded},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(count)
+				for pb.Next() {
+					bc.store.CheckAddress(addresses[i%count])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// BloomFilterType is the name of the classic Bloom filter backend.
+const BloomFilterType = "bloom"
+
+func init() {
+	RegisterFilter(BloomFilterType, func() Filter { return &BloomFilter{filter: &bloom.BloomFilter{}} })
+}
+
+// BloomFilter implements Filter on top of bits-and-blooms/bloom. Its serialized form is the
+// plain bloom.BloomFilter stream, so files written before Filter existed remain readable.
+type BloomFilter struct {
+	filter *bloom.BloomFilter
+}
+
+// NewBloomFilter creates a Bloom filter sized for capacity elements at the given false positive rate.
+func NewBloomFilter(capacity uint, falsePositiveRate float64) *BloomFilter {
+	return &BloomFilter{filter: bloom.NewWithEstimates(capacity, falsePositiveRate)}
+}
+
+// Add inserts data into the filter.
+func (f *BloomFilter) Add(data []byte) error {
+	f.filter.Add(data)
+	return nil
+}
+
+// Test reports whether data is possibly in the filter.
+func (f *BloomFilter) Test(data []byte) bool {
+	return f.filter.Test(data)
+}
+
+// WriteTo writes the filter to w.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	return f.filter.WriteTo(w)
+}
+
+// ReadFrom reads the filter from r.
+func (f *BloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	return f.filter.ReadFrom(r)
+}
+
+// Type returns BloomFilterType.
+func (f *BloomFilter) Type() string {
+	return BloomFilterType
+}
+
+// Stats returns the parameters, fill and approximate element count of the filter.
+func (f *BloomFilter) Stats() FilterStats {
+	stats := bloomStats(f.filter)
+	stats.Type = BloomFilterType
+	return stats
+}
+
+// bloomStats computes the statistics of a bloom.BloomFilter. The estimated false positive rate is
+// the probability that k bits picked at random are all set.
+func bloomStats(filter *bloom.BloomFilter) FilterStats {
+	stats := FilterStats{
+		Capacity:         filter.Cap(),
+		HashFunctions:    filter.K(),
+		BitsSet:          filter.BitSet().Count(),
+		ApproximateCount: uint(filter.ApproximatedSize()),
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(stats.BitsSet) / float64(stats.Capacity)
+		stats.EstimatedFalsePositiveRate = math.Pow(stats.FillRatio, float64(stats.HashFunctions))
+	}
+	return stats
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// CuckooFilterType is the name of the cuckoo filter backend.
+const CuckooFilterType = "cuckoo"
+
+const (
+	cuckooBucketSize = 4   // Fingerprints per bucket.
+	cuckooMaxKicks   = 500 // Relocations attempted before declaring the filter full.
+
+	cuckooChunkBuckets = 4096    // Buckets encoded per write when serializing.
+	cuckooMaxBuckets   = 1 << 32 // Buckets of a filter read from a file at most.
+)
+
+// ErrFilterFull is returned when an element cannot be inserted because the filter has no room left.
+var ErrFilterFull = errors.New("filter is full")
+
+func init() {
+	RegisterFilter(CuckooFilterType, func() Filter { return &CuckooFilter{} })
+}
+
+// CuckooFilter implements Filter with a cuckoo filter using 16-bit fingerprints and buckets of
+// four entries, giving a false positive rate of roughly 1.2e-4. Unlike a Bloom filter it
+// supports removing elements.
+type CuckooFilter struct {
+	buckets [][cuckooBucketSize]uint16
+	count   uint
+	victim  uint16 // Fingerprint evicted by the last failed insert, 0 if none.
+	victimI uint64 // Bucket index of the victim.
+}
+
+// NewCuckooFilter creates a cuckoo filter able to hold at least capacity elements.
+func NewCuckooFilter(capacity uint) *CuckooFilter {
+	numBuckets := uint64(1)
+	for numBuckets*cuckooBucketSize < uint64(capacity) {
+		numBuckets <<= 1
+	}
+	return &CuckooFilter{buckets: make([][cuckooBucketSize]uint16, numBuckets)}
+}
+
+// indexes returns the fingerprint and the two candidate buckets for data.
+func (f *CuckooFilter) indexes(data []byte) (uint16, uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(data)
+	sum := h.Sum64()
+
+	fp := uint16(sum >> 48)
+	if fp == 0 {
+		fp = 1 // 0 marks an empty slot.
+	}
+	i1 := sum & f.mask()
+	return fp, i1, f.altIndex(i1, fp)
+}
+
+// altIndex returns the other candidate bucket of a fingerprint stored in bucket i.
+func (f *CuckooFilter) altIndex(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & f.mask()
+}
+
+func (f *CuckooFilter) mask() uint64 {
+	return uint64(len(f.buckets)) - 1
+}
+
+func (f *CuckooFilter) insert(i uint64, fp uint16) bool {
+	for j, slot := range f.buckets[i] {
+		if slot == 0 {
+			f.buckets[i][j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+// Add inserts data into the filter. It returns ErrFilterFull once the filter cannot take more elements.
+func (f *CuckooFilter) Add(data []byte) error {
+	_, err := f.Insert(data)
+	return err
+}
+
+// Insert inserts data into the filter like Add, reporting whether it was inserted. Elements that
+// test as present are not inserted again, so that one Remove deletes an element added twice.
+func (f *CuckooFilter) Insert(data []byte) (bool, error) {
+	if f.Test(data) {
+		return false, nil
+	}
+	if f.victim != 0 {
+		return false, ErrFilterFull
+	}
+
+	fp, i1, i2 := f.indexes(data)
+	if f.insert(i1, fp) || f.insert(i2, fp) {
+		f.count++
+		return true, nil
+	}
+
+	// Both buckets are full, relocate existing fingerprints to make room.
+	i := i1
+	if rand.Intn(2) == 1 {
+		i = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		j := rand.Intn(cuckooBucketSize)
+		fp, f.buckets[i][j] = f.buckets[i][j], fp
+		i = f.altIndex(i, fp)
+		if f.insert(i, fp) {
+			f.count++
+			return true, nil
+		}
+	}
+
+	// Keep the last evicted fingerprint so no previously added element is lost.
+	f.victim, f.victimI = fp, i
+	f.count++
+	return true, nil
+}
+
+// Test reports whether data is possibly in the filter.
+func (f *CuckooFilter) Test(data []byte) bool {
+	if len(f.buckets) == 0 {
+		return false
+	}
+	fp, i1, i2 := f.indexes(data)
+	if f.victim == fp && (f.victimI == i1 || f.victimI == i2) {
+		return true
+	}
+	for _, slot := range f.buckets[i1] {
+		if slot == fp {
+			return true
+		}
+	}
+	for _, slot := range f.buckets[i2] {
+		if slot == fp {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove deletes one occurrence of data from the filter and reports whether it was found.
+// Removing an element that was never added may delete a colliding element.
+func (f *CuckooFilter) Remove(data []byte) bool {
+	if len(f.buckets) == 0 {
+		return false
+	}
+	fp, i1, i2 := f.indexes(data)
+	if f.victim == fp && (f.victimI == i1 || f.victimI == i2) {
+		f.victim, f.victimI = 0, 0
+		f.count--
+		return true
+	}
+	for _, i := range []uint64{i1, i2} {
+		for j, slot := range f.buckets[i] {
+			if slot == fp {
+				f.buckets[i][j] = 0
+				f.count--
+				// A slot was freed, try to move the victim back into the table.
+				if f.victim != 0 && (f.insert(f.victimI, f.victim) || f.insert(f.altIndex(f.victimI, f.victim), f.victim)) {
+					f.victim, f.victimI = 0, 0
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteTo writes the filter to w.
+func (f *CuckooFilter) WriteTo(w io.Writer) (int64, error) {
+	header := []uint64{uint64(len(f.buckets)), uint64(f.count), uint64(f.victim), f.victimI}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	buf := make([]byte, cuckooBucketSize*2*cuckooChunkBuckets)
+	for start := 0; start < len(f.buckets); start += cuckooChunkBuckets {
+		chunk := f.buckets[start:min(start+cuckooChunkBuckets, len(f.buckets))]
+		for i, bucket := range chunk {
+			for j, fp := range bucket {
+				binary.BigEndian.PutUint16(buf[(i*cuckooBucketSize+j)*2:], fp)
+			}
+		}
+		written, err := w.Write(buf[:len(chunk)*cuckooBucketSize*2])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads the filter from r.
+func (f *CuckooFilter) ReadFrom(r io.Reader) (int64, error) {
+	header := make([]uint64, 4)
+	if err := binary.Read(r, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	numBuckets := header[0]
+	if numBuckets == 0 || numBuckets&(numBuckets-1) != 0 {
+		return int64(len(header) * 8), errors.New("invalid cuckoo filter: bucket count must be a power of two")
+	}
+	if numBuckets > cuckooMaxBuckets {
+		return int64(len(header) * 8), errors.New("invalid cuckoo filter: too many buckets")
+	}
+	if header[2] > math.MaxUint16 || header[3] >= numBuckets {
+		return int64(len(header) * 8), errors.New("invalid cuckoo filter: bad victim")
+	}
+
+	// Buckets are allocated as they are read, so a corrupted count fails on the end of the data
+	// rather than allocating memory for buckets that are not there.
+	n := int64(len(header) * 8)
+	buckets := make([][cuckooBucketSize]uint16, 0, min(numBuckets, cuckooChunkBuckets))
+	buf := make([]byte, cuckooBucketSize*2*cuckooChunkBuckets)
+	for uint64(len(buckets)) < numBuckets {
+		size := int(min(numBuckets-uint64(len(buckets)), cuckooChunkBuckets))
+		read, err := io.ReadFull(r, buf[:size*cuckooBucketSize*2])
+		n += int64(read)
+		if err != nil {
+			return n, err
+		}
+		for i := 0; i < size; i++ {
+			var bucket [cuckooBucketSize]uint16
+			for j := range bucket {
+				bucket[j] = binary.BigEndian.Uint16(buf[(i*cuckooBucketSize+j)*2:])
+			}
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	f.buckets = buckets
+	f.count = uint(header[1])
+	f.victim = uint16(header[2])
+	f.victimI = header[3]
+	return n, nil
+}
+
+// Type returns CuckooFilterType.
+func (f *CuckooFilter) Type() string {
+	return CuckooFilterType
+}
+
+// Stats returns the number of slots and elements of the filter. A lookup compares against the
+// fingerprints in two buckets, so the estimated false positive rate grows with the fill ratio.
+func (f *CuckooFilter) Stats() FilterStats {
+	stats := FilterStats{
+		Type:             CuckooFilterType,
+		Capacity:         uint(len(f.buckets) * cuckooBucketSize),
+		HashFunctions:    2,
+		ApproximateCount: f.count,
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(f.count) / float64(stats.Capacity)
+		stats.EstimatedFalsePositiveRate = 1 - math.Pow(1-1.0/(1<<16), 2*cuckooBucketSize*stats.FillRatio)
+	}
+	return stats
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestCuckooFilterStoreRemoveAddress(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	keys := securedata.GenerateTestKeys(t)
+	aliceKeyPriv, aliceKeyPub := keys[0], keys[1]
+	bobKeyPriv, bobKeyPub := keys[2], keys[3]
+
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(aliceKeyPriv), securedata.WithPublicKey(bobKeyPub))
+	require.NoError(t, err, "Failed to create Alice's writer")
+
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(bobKeyPriv), securedata.WithPublicKey(aliceKeyPub))
+	require.NoError(t, err, "Failed to create Bob's reader")
+
+	tests := []struct {
+		name        string
+		writer_opts []Option
+		reader_opts []Option
+	}{
+		{name: "plain", writer_opts: []Option{WithFilter(NewCuckooFilter(100))}, reader_opts: []Option{WithFilter(NewCuckooFilter(0))}},
+		{name: "WithEncryption", writer_opts: []Option{WithFilter(NewCuckooFilter(100)), WithSecureDataHandler(aliceWriter)}, reader_opts: []Option{WithFilter(NewCuckooFilter(0)), WithSecureDataHandler(bobReader)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bf, err := NewBloomFilterStore(addressHandler, tt.writer_opts...)
+			require.NoError(t, err, "Failed to create BloomFilterStore")
+
+			addresses := []string{createAddress(), createAddress(), createAddress()}
+			addAddressesToBloomFilter(t, bf, addresses)
+
+			// Adding an address again does not insert it twice, so a single removal deletes it.
+			require.NoError(t, bf.AddAddress(addresses[0]))
+			require.Equal(t, uint64(len(addresses)), bf.Metadata().ElementCount)
+			require.NoError(t, bf.RemoveAddress(addresses[0]))
+			found, err := bf.CheckAddress(addresses[0])
+			require.NoError(t, err)
+			require.False(t, found, "Removed address should not be present")
+			require.Error(t, bf.RemoveAddress(createAddress()), "Expected error when removing an absent address")
+
+			filePath := saveBloomFilterToFile(t, bf)
+			defer os.Remove(filePath)
+
+			bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler, tt.reader_opts...)
+			require.NoError(t, err, "Failed to load cuckoo filter from file")
+			checkAddressesInBloomFilter(t, bfReloaded, addresses[1:])
+
+			found, err = bfReloaded.CheckAddress(addresses[0])
+			require.NoError(t, err)
+			require.False(t, found, "Removed address should not be present after reload")
+		})
+	}
+}
+
+func TestBloomFilterStoreRemoveAddressUnsupported(t *testing.T) {
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{})
+	require.NoError(t, err)
+
+	addr := createAddress()
+	require.NoError(t, bf.AddAddress(addr))
+	require.Error(t, bf.RemoveAddress(addr), "Bloom filter should not support removal")
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	f := NewCuckooFilter(8)
+
+	var added [][]byte
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		data := sha256.Sum256([]byte{byte(i)})
+		if err = f.Add(data[:]); err == nil {
+			added = append(added, data[:])
+		}
+	}
+	require.ErrorIs(t, err, ErrFilterFull)
+
+	// Every element accepted before the filter filled up must still be found.
+	for _, data := range added {
+		require.True(t, f.Test(data))
+	}
+
+	var buf bytes.Buffer
+	_, err = f.WriteTo(&buf)
+	require.NoError(t, err)
+
+	var reloaded CuckooFilter
+	_, err = reloaded.ReadFrom(&buf)
+	require.NoError(t, err)
+	require.Equal(t, f.Stats(), reloaded.Stats())
+	for _, data := range added {
+		require.True(t, reloaded.Test(data))
+	}
+}
+
+func TestCuckooFilterReadFromCorrupted(t *testing.T) {
+	// A header claiming more buckets than follow must fail without allocating them all.
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, []uint64{1 << 32, 0, 0, 0}))
+	buf.Write(make([]byte, 64))
+	_, err := new(CuckooFilter).ReadFrom(&buf)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	buf.Reset()
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, []uint64{1 << 40, 0, 0, 0}))
+	_, err = new(CuckooFilter).ReadFrom(&buf)
+	require.Error(t, err)
+
+	// A victim outside the table is rejected rather than indexed out of range on the next Remove.
+	buf.Reset()
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, []uint64{1, 1, 42, 1}))
+	buf.Write(make([]byte, cuckooBucketSize*2))
+	_, err = new(CuckooFilter).ReadFrom(&buf)
+	require.Error(t, err)
+}
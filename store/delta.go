@@ -0,0 +1,325 @@
+package store
+
+import (
+	"addressdb/securedata"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Delta file layout:
+//
+//	magic "ZKDL" | version uint16 | header length uint32 | header JSON | body
+//
+// The header is the metadata of the target filter, with Checksum set to the checksum of the target
+// and BaseChecksum to the checksum of the filter the delta applies to. The body, encrypted like filter
+// files, holds the raw header of the target file, the size and hash count of the Bloom filter, the
+// positions of the bits set since the base as varint gaps, and a SHA-256 checksum of the delta
+// header and the preceding body bytes.
+const deltaMagic = "ZKDL"
+
+// maxDeltaHeaderLength bounds the size of the target header carried by a delta.
+const maxDeltaHeaderLength = maxHeaderLength
+
+var (
+	// ErrNotDelta is returned when reading a file that is not a delta.
+	ErrNotDelta = errors.New("not a delta file")
+	// ErrDeltaBase is returned when a delta does not apply to the loaded filter.
+	ErrDeltaBase = errors.New("delta does not apply to the loaded filter")
+)
+
+// DeltaPath returns the path of the delta file watched next to the filter file filePath.
+func DeltaPath(filePath string) string {
+	return filePath + ".delta"
+}
+
+// IsDeltaFile reports whether filePath holds a delta.
+func IsDeltaFile(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	prefix := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(f, prefix); err != nil {
+		return false, nil
+	}
+	return string(prefix) == deltaMagic, nil
+}
+
+// WriteDelta writes the bits set in to since from, so that a store holding from can be updated
+// to to with ApplyDelta. Both must be Bloom filters of the same size, loaded from or saved to files,
+// and to must only add bits to from. The delta is encrypted and signed with handler, unless it is nil.
+func WriteDelta(w io.Writer, from, to *BloomFilterStore, handler securedata.SecureDataHandler) error {
+	fromSnapshot, locked := from.load()
+	if locked {
+		defer from.mu.RUnlock()
+	}
+	toSnapshot, locked := to.load()
+	if locked {
+		defer to.mu.RUnlock()
+	}
+
+	base, ok := fromSnapshot.filter.(*BloomFilter)
+	if !ok {
+		return fmt.Errorf("deltas need Bloom filters, base is %q", fromSnapshot.filter.Type())
+	}
+	target, ok := toSnapshot.filter.(*BloomFilter)
+	if !ok {
+		return fmt.Errorf("deltas need Bloom filters, target is %q", toSnapshot.filter.Type())
+	}
+	if base.filter.Cap() != target.filter.Cap() || base.filter.K() != target.filter.K() {
+		return errors.New("base and target filters have different sizes")
+	}
+	if fromSnapshot.metadata.Checksum == "" || toSnapshot.metadata.Checksum == "" {
+		return errors.New("base and target must be loaded from or saved to files")
+	}
+	if fromSnapshot.metadata.AddressType != toSnapshot.metadata.AddressType || fromSnapshot.metadata.KeyID != toSnapshot.metadata.KeyID {
+		return errors.New("base and target hold different address types or keys")
+	}
+	if toSnapshot.exact != nil {
+		return errors.New("filters with an exact tier cannot be updated with deltas")
+	}
+
+	// Rebuild the raw header of the target file and check it against its checksum.
+	targetMetadata := toSnapshot.metadata
+	targetMetadata.Checksum = ""
+	var targetHeader bytes.Buffer
+	if _, err := writeHeader(&targetHeader, &targetMetadata); err != nil {
+		return err
+	}
+	if checksum, err := filterChecksum(targetHeader.Bytes(), target); err != nil {
+		return err
+	} else if checksum != toSnapshot.metadata.Checksum {
+		return errors.New("target metadata does not match its file")
+	}
+
+	var positions []uint
+	baseBits, targetBits := base.filter.BitSet(), target.filter.BitSet()
+	for i, ok := baseBits.NextSet(0); ok; i, ok = baseBits.NextSet(i + 1) {
+		if !targetBits.Test(i) {
+			return errors.New("target clears bits of the base, it must be shipped as a full file")
+		}
+	}
+	for i, ok := targetBits.NextSet(0); ok; i, ok = targetBits.NextSet(i + 1) {
+		if !baseBits.Test(i) {
+			positions = append(positions, i)
+		}
+	}
+
+	metadata := toSnapshot.metadata
+	metadata.BaseChecksum = fromSnapshot.metadata.Checksum
+	metadata.Encrypted = handler != nil
+	bw := bufio.NewWriter(w)
+	header, err := writeMagicHeader(bw, deltaMagic, &metadata)
+	if err != nil {
+		return err
+	}
+
+	var body io.WriteCloser = nopWriteCloser{bw}
+	if handler != nil {
+		if body, err = handler.Writer(bw); err != nil {
+			return fmt.Errorf("failed to encrypt delta: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(targetHeader.Len()))
+	buf.Write(targetHeader.Bytes())
+	binary.Write(&buf, binary.BigEndian, uint64(target.filter.Cap()))
+	binary.Write(&buf, binary.BigEndian, uint64(target.filter.K()))
+	binary.Write(&buf, binary.BigEndian, uint64(len(positions)))
+	var gaps []byte
+	previous := uint(0)
+	for _, position := range positions {
+		gaps = binary.AppendUvarint(gaps, uint64(position-previous))
+		previous = position
+	}
+	binary.Write(&buf, binary.BigEndian, uint64(len(gaps)))
+	buf.Write(gaps)
+
+	hash := sha256.New()
+	hash.Write(header)
+	hash.Write(buf.Bytes())
+	buf.Write(hash.Sum(nil))
+	if _, err := body.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteDeltaFile writes a delta to filePath, see WriteDelta. The file is replaced atomically, so
+// that a ReloadManager watching it never applies a partial delta.
+func WriteDeltaFile(filePath string, from, to *BloomFilterStore, handler securedata.SecureDataHandler) error {
+	f, err := createAtomic(filePath, "")
+	if err != nil {
+		return fmt.Errorf("failed to create delta: %w", err)
+	}
+	defer f.Abort()
+	if err := WriteDelta(f, from, to, handler); err != nil {
+		return err
+	}
+	return f.Commit()
+}
+
+// ApplyDeltaFile applies the delta stored in filePath, see ApplyDelta.
+func (bf *BloomFilterStore) ApplyDeltaFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open delta: %w", err)
+	}
+	defer f.Close()
+	return bf.ApplyDelta(bufio.NewReader(f))
+}
+
+// ApplyDelta updates the filter with a delta written by WriteDelta. The delta must have been made
+// against the loaded filter; its bits are set in a copy of the filter, checked against the checksum
+// of the target before it is published. Applying a delta that was already applied does nothing.
+func (bf *BloomFilterStore) ApplyDelta(r io.Reader) error {
+	metadata, header, err := readMagicHeader(r, deltaMagic, ErrNotDelta)
+	if err != nil {
+		return err
+	}
+	if metadata.AddressType != bf.addressHandler.Type() {
+		return fmt.Errorf("delta holds %q addresses, expected %q", metadata.AddressType, bf.addressHandler.Type())
+	}
+	if metadata.KeyID != bf.hashKeyID() {
+		return fmt.Errorf("delta is keyed with key %q, configured key is %q", metadata.KeyID, bf.hashKeyID())
+	}
+
+	current := bf.Metadata().Checksum
+	if metadata.Checksum == current {
+		return nil
+	}
+	if metadata.BaseChecksum != current {
+		return fmt.Errorf("%w: delta base is %s, loaded filter is %s", ErrDeltaBase, metadata.BaseChecksum, current)
+	}
+
+	var verifier securedata.VerifyDataReader
+	body := r
+	switch {
+	case metadata.Encrypted && bf.secureDataHandler == nil:
+		return fmt.Errorf("delta is encrypted but no secure data handler is configured")
+	case !metadata.Encrypted && bf.secureDataHandler != nil:
+		return fmt.Errorf("delta is not encrypted but a secure data handler is configured")
+	case metadata.Encrypted:
+		if verifier, err = bf.secureDataHandler.Reader(r); err != nil {
+			return fmt.Errorf("failed to decrypt delta: %w", err)
+		}
+		body = verifier
+	}
+
+	hash := sha256.New()
+	hash.Write(header)
+	targetHeader, m, k, positions, err := readDeltaBody(io.TeeReader(body, hash))
+	if err != nil {
+		return fmt.Errorf("failed to read delta: %w", err)
+	}
+	checksum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(body, checksum); err != nil {
+		return fmt.Errorf("failed to read delta checksum: %w", err)
+	}
+	if !bytes.Equal(checksum, hash.Sum(nil)) {
+		return fmt.Errorf("checksum mismatch, delta is corrupted")
+	}
+	if verifier != nil {
+		if err := verifier.VerifySignature(); err != nil {
+			return fmt.Errorf("failed to verify delta signature: %w", err)
+		}
+	}
+	target, _, err := readHeader(bytes.NewReader(targetHeader))
+	if err != nil {
+		return fmt.Errorf("invalid target header in delta: %w", err)
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	s := bf.current.Load()
+	if s.metadata.Checksum != metadata.BaseChecksum {
+		return ErrDeltaBase
+	}
+	if s.exact != nil {
+		return errors.New("filters with an exact tier cannot be updated with deltas")
+	}
+	base, ok := s.filter.(*BloomFilter)
+	if !ok || uint64(base.filter.Cap()) != m || uint64(base.filter.K()) != k {
+		return fmt.Errorf("%w: filter type or size differs", ErrDeltaBase)
+	}
+
+	// The bits are set in a copy, published once it matches the target.
+	filter := &BloomFilter{filter: base.filter.Copy()}
+	bits := filter.filter.BitSet()
+	for _, position := range positions {
+		if position >= filter.filter.Cap() {
+			return errors.New("delta sets a bit outside the filter")
+		}
+		bits.Set(position)
+	}
+	if checksum, err := filterChecksum(targetHeader, filter); err != nil || checksum != metadata.Checksum {
+		return errors.New("filter does not match the delta target after applying it")
+	}
+
+	target.Checksum = metadata.Checksum
+	bf.publish(&snapshot{filter: filter, info: s.info, metadata: *target})
+	return nil
+}
+
+// readDeltaBody reads the target header, filter parameters and bit positions of a delta.
+func readDeltaBody(r io.Reader) ([]byte, uint64, uint64, []uint, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, 0, 0, nil, err
+	}
+	if length > maxDeltaHeaderLength {
+		return nil, 0, 0, nil, fmt.Errorf("target header too large: %d bytes", length)
+	}
+	targetHeader := make([]byte, length)
+	if _, err := io.ReadFull(r, targetHeader); err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	var params [4]uint64
+	if err := binary.Read(r, binary.BigEndian, &params); err != nil {
+		return nil, 0, 0, nil, err
+	}
+	m, k, count, size := params[0], params[1], params[2], params[3]
+	if count > m || size > count*binary.MaxVarintLen64 {
+		return nil, 0, 0, nil, fmt.Errorf("invalid delta of %d bits in %d bytes", count, size)
+	}
+
+	gaps := make([]byte, size)
+	if _, err := io.ReadFull(r, gaps); err != nil {
+		return nil, 0, 0, nil, err
+	}
+	positions := make([]uint, 0, count)
+	position := uint64(0)
+	for i := uint64(0); i < count; i++ {
+		gap, n := binary.Uvarint(gaps)
+		if n <= 0 {
+			return nil, 0, 0, nil, errors.New("invalid bit position")
+		}
+		gaps = gaps[n:]
+		position += gap
+		positions = append(positions, uint(position))
+	}
+	return targetHeader, m, k, positions, nil
+}
+
+// filterChecksum returns the hex checksum of a filter file with the given raw header.
+func filterChecksum(header []byte, filter Filter) (string, error) {
+	hash := sha256.New()
+	hash.Write(header)
+	if _, err := filter.WriteTo(hash); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelta(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	tests := []struct {
+		name   string
+		writer securedata.SecureDataHandler
+		reader securedata.SecureDataHandler
+	}{
+		{"plain", nil, nil},
+		{"encrypted", aliceWriter, bobReader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writeOpts, readOpts []Option
+			if tt.writer != nil {
+				writeOpts = append(writeOpts, WithSecureDataHandler(tt.writer))
+				readOpts = append(readOpts, WithSecureDataHandler(tt.reader))
+			}
+
+			// Version 1 holds old, version 2 adds added.
+			old, added := createAddress(), createAddress()
+			producer, err := NewBloomFilterStore(addressHandler, append(writeOpts, WithEstimates(1000, 0.001))...)
+			require.NoError(t, err)
+			addAddressesToBloomFilter(t, producer, []string{old})
+			basePath, targetPath := os.TempDir()+"/bloomfilter-v1.gob", os.TempDir()+"/bloomfilter-v2.gob"
+			require.NoError(t, producer.SaveToFile(basePath))
+			defer os.Remove(basePath)
+			addAddressesToBloomFilter(t, producer, []string{added})
+			require.NoError(t, producer.SaveToFile(targetPath))
+			defer os.Remove(targetPath)
+
+			from := mustLoad(t, basePath, addressHandler, readOpts...)
+			to := mustLoad(t, targetPath, addressHandler, readOpts...)
+			var delta bytes.Buffer
+			require.NoError(t, WriteDelta(&delta, from, to, tt.writer))
+
+			consumer := mustLoad(t, basePath, addressHandler, readOpts...)
+			checkAddressesInBloomFilter(t, consumer, []string{old})
+			require.NoError(t, consumer.ApplyDelta(bytes.NewReader(delta.Bytes())))
+			checkAddressesInBloomFilter(t, consumer, []string{old, added})
+			require.Equal(t, to.Metadata(), consumer.Metadata())
+
+			// Applying it again does nothing.
+			require.NoError(t, consumer.ApplyDelta(bytes.NewReader(delta.Bytes())))
+
+			// A delta does not apply to another base.
+			other, err := NewBloomFilterStore(addressHandler, append(writeOpts, WithEstimates(1000, 0.001))...)
+			require.NoError(t, err)
+			otherPath := os.TempDir() + "/bloomfilter-other.gob"
+			require.NoError(t, other.SaveToFile(otherPath))
+			defer os.Remove(otherPath)
+			err = mustLoad(t, otherPath, addressHandler, readOpts...).ApplyDelta(bytes.NewReader(delta.Bytes()))
+			require.ErrorIs(t, err, ErrDeltaBase)
+
+			// A corrupted delta leaves the filter unchanged.
+			corrupted := append([]byte{}, delta.Bytes()...)
+			corrupted[len(corrupted)-10] ^= 1
+			fresh := mustLoad(t, basePath, addressHandler, readOpts...)
+			require.Error(t, fresh.ApplyDelta(bytes.NewReader(corrupted)))
+			found, err := fresh.CheckAddress(added)
+			require.NoError(t, err)
+			require.False(t, found)
+			require.Equal(t, from.Metadata(), fresh.Metadata())
+		})
+	}
+}
+
+func TestDeltaRejectsClearedBits(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	first, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, first, []string{createAddress()})
+	firstPath := os.TempDir() + "/bloomfilter-first.gob"
+	require.NoError(t, first.SaveToFile(firstPath))
+	defer os.Remove(firstPath)
+
+	second, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, second, []string{createAddress()})
+	secondPath := os.TempDir() + "/bloomfilter-second.gob"
+	require.NoError(t, second.SaveToFile(secondPath))
+	defer os.Remove(secondPath)
+
+	var delta bytes.Buffer
+	require.Error(t, WriteDelta(&delta, first, second, nil))
+}
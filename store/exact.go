@@ -0,0 +1,190 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Match is the result of checking an address against a store.
+type Match int
+
+const (
+	NotPresent      Match = iota // The address is definitely not in the set.
+	PossiblyPresent              // The filter matched, the address may be a false positive.
+	Present                      // The address is in the set, confirmed by the exact tier.
+)
+
+func (m Match) String() string {
+	switch m {
+	case NotPresent:
+		return "not present"
+	case PossiblyPresent:
+		return "possibly present"
+	case Present:
+		return "present"
+	}
+	return fmt.Sprintf("Match(%d)", int(m))
+}
+
+// maxExactKeySize bounds the size of keys read from an exact set.
+const maxExactKeySize = 1 << 10
+
+// exactSet holds the exact keys inserted in a filter, to confirm filter matches. Keys are kept in a
+// sorted array, and keys added since the last compaction in a map.
+type exactSet struct {
+	sorted  [][]byte
+	pending map[string]struct{}
+}
+
+func newExactSet() *exactSet {
+	return &exactSet{pending: make(map[string]struct{})}
+}
+
+func (s *exactSet) search(key []byte) (int, bool) {
+	i := sort.Search(len(s.sorted), func(i int) bool { return bytes.Compare(s.sorted[i], key) >= 0 })
+	return i, i < len(s.sorted) && bytes.Equal(s.sorted[i], key)
+}
+
+func (s *exactSet) Add(key []byte) {
+	if _, found := s.search(key); !found {
+		s.pending[string(key)] = struct{}{}
+	}
+}
+
+func (s *exactSet) Remove(key []byte) {
+	delete(s.pending, string(key))
+	if i, found := s.search(key); found {
+		s.sorted = append(s.sorted[:i], s.sorted[i+1:]...)
+	}
+}
+
+func (s *exactSet) Contains(key []byte) bool {
+	if _, found := s.search(key); found {
+		return true
+	}
+	_, found := s.pending[string(key)]
+	return found
+}
+
+func (s *exactSet) Len() int {
+	return len(s.sorted) + len(s.pending)
+}
+
+// retain removes the keys for which keep returns false.
+func (s *exactSet) retain(keep func(key []byte) bool) {
+	var kept [][]byte
+	for _, key := range s.keys() {
+		if keep(key) {
+			kept = append(kept, key)
+		}
+	}
+	s.sorted, s.pending = kept, make(map[string]struct{})
+}
+
+// compact merges the pending keys into the sorted array.
+func (s *exactSet) compact() {
+	if len(s.pending) == 0 {
+		return
+	}
+	s.sorted = s.keys()
+	s.pending = make(map[string]struct{})
+}
+
+// keys returns all the keys of the set, sorted, without modifying it.
+func (s *exactSet) keys() [][]byte {
+	if len(s.pending) == 0 {
+		return s.sorted
+	}
+	pending := make([][]byte, 0, len(s.pending))
+	for key := range s.pending {
+		pending = append(pending, []byte(key))
+	}
+	sort.Slice(pending, func(i, j int) bool { return bytes.Compare(pending[i], pending[j]) < 0 })
+
+	merged := make([][]byte, 0, len(s.sorted)+len(pending))
+	i, j := 0, 0
+	for i < len(s.sorted) && j < len(pending) {
+		if bytes.Compare(s.sorted[i], pending[j]) < 0 {
+			merged, i = append(merged, s.sorted[i]), i+1
+		} else {
+			merged, j = append(merged, pending[j]), j+1
+		}
+	}
+	return append(append(merged, s.sorted[i:]...), pending[j:]...)
+}
+
+// WriteTo writes the number of keys followed by each key prefixed with its length, in sorted order.
+// It does not modify the set, so it can be called under a read lock.
+func (s *exactSet) WriteTo(w io.Writer) (int64, error) {
+	keys := s.keys()
+	bw := bufio.NewWriter(w)
+	var written int64
+
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(len(keys)))
+	n, err := bw.Write(header[:])
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	for _, key := range keys {
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(key)))
+		n, err := bw.Write(length[:])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		n, err = bw.Write(key)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// ReadFrom reads a set written by WriteTo. It reads exactly the bytes written, so that data
+// following the set can be read from r.
+func (s *exactSet) ReadFrom(r io.Reader) (int64, error) {
+	var read int64
+	var header [8]byte
+	n, err := io.ReadFull(r, header[:])
+	read += int64(n)
+	if err != nil {
+		return read, err
+	}
+	count := binary.BigEndian.Uint64(header[:])
+
+	keys := make([][]byte, 0, min(count, 1<<20))
+	for i := uint64(0); i < count; i++ {
+		var length [2]byte
+		n, err := io.ReadFull(r, length[:])
+		read += int64(n)
+		if err != nil {
+			return read, err
+		}
+		size := binary.BigEndian.Uint16(length[:])
+		if size > maxExactKeySize {
+			return read, fmt.Errorf("exact key too large: %d bytes", size)
+		}
+		key := make([]byte, size)
+		n, err = io.ReadFull(r, key)
+		read += int64(n)
+		if err != nil {
+			return read, err
+		}
+		if len(keys) > 0 && bytes.Compare(keys[len(keys)-1], key) >= 0 {
+			return read, fmt.Errorf("exact keys are not sorted")
+		}
+		keys = append(keys, key)
+	}
+
+	s.sorted = keys
+	s.pending = make(map[string]struct{})
+	return read, nil
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExactMatch(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	// A tiny filter so that most absent addresses are false positives.
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(10, 0.5), WithExactMatch(), WithSecureDataHandler(aliceWriter))
+	require.NoError(t, err)
+	require.True(t, bf.Exact())
+	present := make([]string, 50)
+	for i := range present {
+		present[i] = createAddress()
+	}
+	addAddressesToBloomFilter(t, bf, present)
+
+	filePath := os.TempDir() + "/bloomfilter-exact.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	defer os.Remove(filePath)
+
+	for _, store := range []*BloomFilterStore{bf, mustLoad(t, filePath, addressHandler, WithSecureDataHandler(bobReader))} {
+		require.True(t, store.Metadata().Exact)
+		for _, addr := range present {
+			match, err := store.MatchAddress(addr)
+			require.NoError(t, err)
+			require.Equal(t, Present, match)
+		}
+		for i := 0; i < 50; i++ {
+			match, err := store.MatchAddress(createAddress())
+			require.NoError(t, err)
+			require.Equal(t, NotPresent, match, "Expected the exact tier to rule out false positives")
+		}
+	}
+
+	// Without the exact tier, the same filter only reports possible matches.
+	plain, err := NewBloomFilterStore(addressHandler, WithEstimates(10, 0.5))
+	require.NoError(t, err)
+	require.False(t, plain.Exact())
+	addAddressesToBloomFilter(t, plain, present[:1])
+	match, err := plain.MatchAddress(present[0])
+	require.NoError(t, err)
+	require.Equal(t, PossiblyPresent, match)
+}
+
+func TestExactMatchRemove(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	bf, err := NewBloomFilterStore(addressHandler, WithFilter(NewCuckooFilter(100)), WithExactMatch())
+	require.NoError(t, err)
+	kept, removed := createAddress(), createAddress()
+	addAddressesToBloomFilter(t, bf, []string{kept, removed})
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	loaded := mustLoad(t, filePath, addressHandler)
+	require.Error(t, loaded.RemoveAddress(createAddress()), "Expected error when removing an address missing from the exact tier")
+	require.Equal(t, uint64(2), loaded.Metadata().ElementCount)
+	require.NoError(t, loaded.RemoveAddress(removed))
+	match, err := loaded.MatchAddress(removed)
+	require.NoError(t, err)
+	require.Equal(t, NotPresent, match)
+	match, err = loaded.MatchAddress(kept)
+	require.NoError(t, err)
+	require.Equal(t, Present, match)
+}
+
+func TestExactSetWriteTo(t *testing.T) {
+	set := newExactSet()
+	for _, key := range []string{"d", "b", "f"} {
+		set.Add([]byte(key))
+	}
+	set.compact()
+	for _, key := range []string{"e", "a", "c"} {
+		set.Add([]byte(key))
+	}
+
+	// Writing merges the pending keys into the output without modifying the set, which may only be
+	// read locked.
+	var buf bytes.Buffer
+	_, err := set.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Len(t, set.pending, 3)
+
+	read := newExactSet()
+	_, err = read.ReadFrom(&buf)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"), []byte("f")}, read.sorted)
+}
+
+func mustLoad(t *testing.T, filePath string, addressHandler address.AddressHandler, opts ...Option) *BloomFilterStore {
+	bf, err := NewBloomFilterStoreFromFile(filePath, addressHandler, opts...)
+	require.NoError(t, err)
+	return bf
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Filter defines the interface for the probabilistic data structure backing a BloomFilterStore.
+type Filter interface {
+	Add(data []byte) error               // Insert an element into the filter.
+	Test(data []byte) bool               // Report whether an element is possibly in the filter.
+	WriteTo(w io.Writer) (int64, error)  // Serialize the filter.
+	ReadFrom(r io.Reader) (int64, error) // Deserialize the filter, replacing its contents.
+	Type() string                        // Name of the filter backend, used to look up its factory.
+	Stats() FilterStats                  // Parameters and usage statistics of the filter.
+}
+
+// Remover is implemented by Filter backends that support deleting elements.
+type Remover interface {
+	Remove(data []byte) bool // Delete an element, reporting whether it was found.
+}
+
+// Inserter is implemented by Filter backends that may skip inserting an element, e.g. one that
+// already tests as present. Stores only count the elements such backends report as inserted.
+type Inserter interface {
+	Insert(data []byte) (bool, error) // Insert an element, reporting whether it was inserted.
+}
+
+// Expirer is implemented by Filter backends whose elements expire. Stores drop the exact tier
+// entries, commitment leaves and address info of expired elements along with them, and count only
+// the live elements.
+type Expirer interface {
+	Expired() bool // Report whether the filter holds expired elements.
+	Expire()       // Drop the expired elements.
+}
+
+// FilterStats describes the parameters and usage of a Filter.
+type FilterStats struct {
+	Type                       string  `json:"type"`
+	Capacity                   uint    `json:"capacity"`                      // Size of the filter (m), in bits or slots depending on the backend.
+	HashFunctions              uint    `json:"hash_functions"`                // Number of hash functions (k) or candidate slots per element.
+	BitsSet                    uint    `json:"bits_set,omitempty"`            // Number of bits set, for Bloom filter backends.
+	FillRatio                  float64 `json:"fill_ratio"`                    // Fraction of bits or slots in use.
+	ApproximateCount           uint    `json:"approximate_count"`             // Approximate number of elements inserted.
+	EstimatedFalsePositiveRate float64 `json:"estimated_false_positive_rate"` // False positive rate at the current fill.
+	Slices                     uint    `json:"slices,omitempty"`              // Number of sub-filters, for backends that grow.
+}
+
+var (
+	filterFactoriesMu sync.RWMutex
+	filterFactories   = map[string]func() Filter{}
+)
+
+// RegisterFilter makes a Filter backend available by name, so that stores can create empty
+// instances of it when loading from a file.
+func RegisterFilter(name string, factory func() Filter) {
+	filterFactoriesMu.Lock()
+	defer filterFactoriesMu.Unlock()
+	filterFactories[name] = factory
+}
+
+// newFilter creates an empty Filter of the named backend.
+func newFilter(name string) (Filter, error) {
+	filterFactoriesMu.RLock()
+	defer filterFactoriesMu.RUnlock()
+	factory, ok := filterFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter type: %q", name)
+	}
+	return factory(), nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"addressdb/address"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// File layout:
+//
+//	magic "ZKAS" | version uint16 | header length uint32 | header JSON | body
+//
+// The body holds the serialized filter, the exact tier if the header says so, and a SHA-256
+// checksum of the header bytes and the preceding body bytes. When the file is encrypted the whole body goes through the SecureDataHandler, so
+// the checksum is covered by the signature. Files without the magic are read as legacy files
+// containing only the serialized filter.
+const (
+	formatMagic = "ZKAS"
+
+	// FormatVersion is the version of the file format written by SaveToFile.
+	FormatVersion uint16 = 1
+
+	maxHeaderLength = 1 << 20
+)
+
+// ErrLegacyFormat is returned by ReadMetadata for files written before the versioned format existed.
+var ErrLegacyFormat = errors.New("legacy file without header")
+
+// Metadata describes a serialized filter. It is stored unencrypted in the file header so it can be
+// inspected without the keys needed to read the filter.
+type Metadata struct {
+	Version           uint16    `json:"version"`
+	FilterType        string    `json:"filter_type"`
+	AddressType       string    `json:"address_type"`
+	Capacity          uint      `json:"capacity,omitempty"`            // Targeted number of elements.
+	FalsePositiveRate float64   `json:"false_positive_rate,omitempty"` // Targeted false positive rate.
+	ElementCount      uint64    `json:"element_count"`                 // Number of addresses added.
+	BuildTime         time.Time `json:"build_time"`
+	Source            string    `json:"source,omitempty"`
+	Encrypted         bool      `json:"encrypted"`
+	KeyID             string    `json:"key_id,omitempty"`        // Id of the key addresses are hashed with, see WithHashKey.
+	MerkleRoot        string    `json:"merkle_root,omitempty"`   // Hex root of the commitment to the addresses, see WithCommitment.
+	Exact             bool      `json:"exact,omitempty"`         // The body holds an exact tier after the filter, see WithExactMatch.
+	AddressInfo       bool      `json:"address_info,omitempty"`  // Address info is written next to the file, see WithAddressInfo.
+	Checksum          string    `json:"checksum,omitempty"`      // Hex SHA-256 from the body, set when loading.
+	BaseChecksum      string    `json:"base_checksum,omitempty"` // Checksum of the filter a delta applies to, only set in delta headers.
+}
+
+// writeHeader writes the magic, version and metadata to w and returns the bytes written.
+func writeHeader(w io.Writer, metadata *Metadata) ([]byte, error) {
+	return writeMagicHeader(w, formatMagic, metadata)
+}
+
+// writeMagicHeader writes a header with the given magic, as used by filter and delta files.
+func writeMagicHeader(w io.Writer, magic string, metadata *Metadata) ([]byte, error) {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, metadata.Version)
+	binary.Write(&buf, binary.BigEndian, uint32(len(encoded)))
+	buf.Write(encoded)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readHeader reads the magic, version and metadata from r and returns them with the raw header bytes.
+func readHeader(r io.Reader) (*Metadata, []byte, error) {
+	return readMagicHeader(r, formatMagic, ErrLegacyFormat)
+}
+
+// readMagicHeader reads a header with the given magic, returning errMagic if r starts with another one.
+func readMagicHeader(r io.Reader, magic string, errMagic error) (*Metadata, []byte, error) {
+	prefix := make([]byte, len(magic)+2+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(prefix[:len(magic)]) != magic {
+		return nil, nil, errMagic
+	}
+
+	version := binary.BigEndian.Uint16(prefix[len(magic):])
+	if version == 0 || version > FormatVersion {
+		return nil, nil, fmt.Errorf("unsupported file format version %d", version)
+	}
+
+	length := binary.BigEndian.Uint32(prefix[len(magic)+2:])
+	if length > maxHeaderLength {
+		return nil, nil, fmt.Errorf("header too large: %d bytes", length)
+	}
+	encoded := make([]byte, length)
+	if _, err := io.ReadFull(r, encoded); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(encoded, &metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	metadata.Version = version
+
+	return &metadata, append(prefix, encoded...), nil
+}
+
+// ReadMetadata reads the header of a filter file without decrypting or loading the filter.
+// It returns ErrLegacyFormat if the file has no header.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	metadata, _, err := readHeader(r)
+	return metadata, err
+}
+
+// ReadAddressHandler returns the AddressHandler for the elements of the filter file filePath, as
+// recorded in its header. Legacy files hold EVM addresses.
+func ReadAddressHandler(filePath string) (address.AddressHandler, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	metadata, err := ReadMetadata(f)
+	if errors.Is(err, ErrLegacyFormat) {
+		return &address.EVMAddressHandler{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return address.NewAddressHandler(metadata.AddressType)
+}
+
+// isVersioned reports whether the data starts with the file format magic.
+func isVersioned(prefix []byte) bool {
+	return string(prefix) == formatMagic
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"bufio"
+	"crypto/sha256"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileHeaderMetadata(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(100, 0.001), WithSource("sanctions"))
+	require.NoError(t, err)
+
+	addresses := []string{createAddress(), createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	f, err := os.Open(filePath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	metadata, err := ReadMetadata(f)
+	require.NoError(t, err)
+	require.Equal(t, FormatVersion, metadata.Version)
+	require.Equal(t, BloomFilterType, metadata.FilterType)
+	require.Equal(t, "evm", metadata.AddressType)
+	require.Equal(t, uint(100), metadata.Capacity)
+	require.Equal(t, 0.001, metadata.FalsePositiveRate)
+	require.Equal(t, uint64(3), metadata.ElementCount)
+	require.Equal(t, "sanctions", metadata.Source)
+	require.False(t, metadata.Encrypted)
+	require.WithinDuration(t, time.Now(), metadata.BuildTime, time.Minute)
+
+	// The reader does not need to know the backend, the header tells it.
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler, WithFilter(NewCuckooFilter(0)))
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, bfReloaded, addresses)
+	require.Equal(t, bf.Metadata(), bfReloaded.Metadata())
+	require.NotEmpty(t, bfReloaded.Metadata().Checksum)
+}
+
+func TestFileHeaderEncrypted(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+
+	bf, err := NewBloomFilterStore(addressHandler, WithFilter(NewCuckooFilter(100)), WithSecureDataHandler(aliceWriter))
+	require.NoError(t, err)
+	addresses := []string{createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	f, err := os.Open(filePath)
+	require.NoError(t, err)
+	defer f.Close()
+	metadata, err := ReadMetadata(f)
+	require.NoError(t, err)
+	require.True(t, metadata.Encrypted)
+	require.Equal(t, CuckooFilterType, metadata.FilterType)
+
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.Error(t, err, "Expected error when reading an encrypted file without a secure data handler")
+
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler, WithSecureDataHandler(bobReader))
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, bfReloaded, addresses)
+}
+
+func TestLegacyFileFormat(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	filter := NewBloomFilter(100, 0.001)
+	addresses := []string{createAddress(), createAddress()}
+	for _, addr := range addresses {
+		addressBytes, err := addressHandler.ToBytes(addr)
+		require.NoError(t, err)
+		require.NoError(t, filter.Add(addressBytes))
+	}
+
+	// Write the raw filter stream, as SaveToFile did before the versioned format.
+	f, err := os.CreateTemp("", "legacy-*.gob")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	_, err = filter.WriteTo(w)
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	require.NoError(t, f.Close())
+
+	f, err = os.Open(f.Name())
+	require.NoError(t, err)
+	_, err = ReadMetadata(f)
+	f.Close()
+	require.ErrorIs(t, err, ErrLegacyFormat)
+
+	bf, err := NewBloomFilterStoreFromFile(f.Name(), addressHandler)
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, bf, addresses)
+	require.Equal(t, BloomFilterType, bf.Metadata().FilterType)
+}
+
+func TestFileChecksumMismatch(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(100, 0.001))
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, bf, []string{createAddress()})
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	data[len(data)-sha256.Size-1] ^= 0xff // Corrupt the last byte of the filter.
+	require.NoError(t, os.WriteFile(filePath, data, 0644))
+
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestFileAddressTypeMismatch(t *testing.T) {
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{})
+	require.NoError(t, err)
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	_, err = NewBloomFilterStoreFromFile(filePath, &address.BitcoinAddressHandler{})
+	require.Error(t, err, "Expected error when reading an EVM filter with a Bitcoin handler")
+}
@@ -0,0 +1,248 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// GenerationalBloomFilterType is the name of the generational Bloom filter backend.
+const GenerationalBloomFilterType = "generational-bloom"
+
+// generationalMaxGenerations bounds the number of generations of a filter read from a file.
+const generationalMaxGenerations = 1 << 12
+
+func init() {
+	RegisterFilter(GenerationalBloomFilterType, func() Filter { return &GenerationalBloomFilter{} })
+}
+
+// GenerationalBloomFilter implements Filter with a Bloom filter per time bucket, so that elements
+// expire: each element is added to the generation of the current bucket, and generations whose
+// bucket ended more than the TTL ago are dropped. Elements are therefore matched for at least the
+// TTL and at most the TTL plus one bucket.
+//
+// Expired generations are ignored by Test and left out by WriteTo, and dropped from memory when the
+// filter rotates on Add or by Expire. Each generation holds at most its capacity: once the generation
+// of the current bucket is full, Add returns ErrFilterFull until the next bucket starts.
+type GenerationalBloomFilter struct {
+	capacity          uint          // Capacity of each generation.
+	falsePositiveRate float64       // False positive rate of each generation.
+	ttl               time.Duration // How long elements are matched after being added.
+	bucket            time.Duration // Time span of each generation.
+	generations       []generation  // Oldest first.
+	now               func() time.Time
+}
+
+type generation struct {
+	start  time.Time // Start of the bucket of the generation.
+	filter *bloom.BloomFilter
+	count  uint
+}
+
+// NewGenerationalBloomFilter creates a filter matching elements for ttl, split into the given
+// number of generations. Each generation holds capacity elements, at a false positive rate chosen
+// so that the rate of all live generations together stays below falsePositiveRate.
+func NewGenerationalBloomFilter(capacity uint, falsePositiveRate float64, ttl time.Duration, generations uint) *GenerationalBloomFilter {
+	generations = max(generations, 1)
+	return &GenerationalBloomFilter{
+		capacity:          max(capacity, 1),
+		falsePositiveRate: falsePositiveRate / float64(generations+1),
+		ttl:               ttl,
+		bucket:            max(ttl/time.Duration(generations), time.Nanosecond),
+	}
+}
+
+// clock returns the current time, from now if it is set.
+func (f *GenerationalBloomFilter) clock() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+	return time.Now()
+}
+
+// live reports whether generation g is still matched at now.
+func (f *GenerationalBloomFilter) live(g generation, now time.Time) bool {
+	return now.Before(g.start.Add(f.bucket + f.ttl))
+}
+
+// expired returns the number of expired generations at now, which are the oldest ones.
+func (f *GenerationalBloomFilter) expired(now time.Time) int {
+	expired := 0
+	for expired < len(f.generations) && !f.live(f.generations[expired], now) {
+		expired++
+	}
+	return expired
+}
+
+// Expired reports whether the filter holds expired generations.
+func (f *GenerationalBloomFilter) Expired() bool {
+	return f.expired(f.clock()) > 0
+}
+
+// Expire drops the expired generations.
+func (f *GenerationalBloomFilter) Expire() {
+	f.generations = f.generations[f.expired(f.clock()):]
+}
+
+// rotate drops the expired generations and starts the generation of the current bucket if needed.
+func (f *GenerationalBloomFilter) rotate(now time.Time) {
+	f.generations = f.generations[f.expired(now):]
+
+	start := now.Truncate(f.bucket)
+	if n := len(f.generations); n == 0 || f.generations[n-1].start.Before(start) {
+		f.generations = append(f.generations, generation{
+			start:  start,
+			filter: bloom.NewWithEstimates(f.capacity, f.falsePositiveRate),
+		})
+	}
+}
+
+// Add rotates the filter and inserts data into the generation of the current bucket. It returns
+// ErrFilterFull if that generation already holds its capacity.
+func (f *GenerationalBloomFilter) Add(data []byte) error {
+	_, err := f.Insert(data)
+	return err
+}
+
+// Insert inserts data like Add, reporting whether it was inserted. Elements that test as present
+// in the generation of the current bucket are not inserted again; elements only present in older
+// generations are, so that they are matched for the TTL from now.
+func (f *GenerationalBloomFilter) Insert(data []byte) (bool, error) {
+	f.rotate(f.clock())
+	current := &f.generations[len(f.generations)-1]
+	if current.filter.Test(data) {
+		return false, nil
+	}
+	if current.count >= f.capacity {
+		return false, ErrFilterFull
+	}
+	current.filter.Add(data)
+	current.count++
+	return true, nil
+}
+
+// Test reports whether data is possibly in any live generation of the filter.
+func (f *GenerationalBloomFilter) Test(data []byte) bool {
+	now := f.clock()
+	for _, g := range f.generations {
+		if f.live(g, now) && g.filter.Test(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Generations returns the number of live generations.
+func (f *GenerationalBloomFilter) Generations() int {
+	now, n := f.clock(), 0
+	for _, g := range f.generations {
+		if f.live(g, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTo writes the live generations of the filter to w.
+func (f *GenerationalBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	now := f.clock()
+	var live []generation
+	for _, g := range f.generations {
+		if f.live(g, now) {
+			live = append(live, g)
+		}
+	}
+
+	header := []uint64{uint64(f.capacity), math.Float64bits(f.falsePositiveRate), uint64(f.ttl), uint64(f.bucket), uint64(len(live))}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	for _, g := range live {
+		if err := binary.Write(w, binary.BigEndian, []uint64{uint64(g.start.UnixNano()), uint64(g.count)}); err != nil {
+			return n, err
+		}
+		n += 16
+		written, err := g.filter.WriteTo(w)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads the filter from r.
+func (f *GenerationalBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	header := make([]uint64, 5)
+	if err := binary.Read(r, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	if header[3] == 0 || header[3] > math.MaxInt64 || header[2] > math.MaxInt64 {
+		return n, errors.New("invalid generational Bloom filter: bad time span")
+	}
+	if header[4] > generationalMaxGenerations {
+		return n, errors.New("invalid generational Bloom filter: bad generation count")
+	}
+
+	generations := make([]generation, header[4])
+	for i := range generations {
+		generationHeader := make([]uint64, 2)
+		if err := binary.Read(r, binary.BigEndian, generationHeader); err != nil {
+			return n, err
+		}
+		n += 16
+		generations[i] = generation{
+			start:  time.Unix(0, int64(generationHeader[0])),
+			filter: &bloom.BloomFilter{},
+			count:  uint(generationHeader[1]),
+		}
+		read, err := generations[i].filter.ReadFrom(r)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+
+	f.capacity = uint(header[0])
+	f.falsePositiveRate = math.Float64frombits(header[1])
+	f.ttl = time.Duration(header[2])
+	f.bucket = time.Duration(header[3])
+	f.generations = generations
+	return n, nil
+}
+
+// Type returns GenerationalBloomFilterType.
+func (f *GenerationalBloomFilter) Type() string {
+	return GenerationalBloomFilterType
+}
+
+// Stats returns the totals over the live generations. The estimated false positive rate is the
+// chance that any of them reports a false positive.
+func (f *GenerationalBloomFilter) Stats() FilterStats {
+	stats := FilterStats{Type: GenerationalBloomFilterType}
+	now := f.clock()
+	trueNegativeRate := 1.0
+	for _, g := range f.generations {
+		if !f.live(g, now) {
+			continue
+		}
+		generationStats := bloomStats(g.filter)
+		stats.Capacity += generationStats.Capacity
+		stats.HashFunctions = generationStats.HashFunctions
+		stats.BitsSet += generationStats.BitsSet
+		stats.ApproximateCount += g.count
+		stats.Slices++
+		trueNegativeRate *= 1 - generationStats.EstimatedFalsePositiveRate
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(stats.BitsSet) / float64(stats.Capacity)
+	}
+	stats.EstimatedFalsePositiveRate = 1 - trueNegativeRate
+	return stats
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"addressdb/address"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationalBloomFilterStore(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	day := 24 * time.Hour
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	bf, err := NewBloomFilterStore(addressHandler, WithTTL(4*day, 4, 100, 0.001))
+	require.NoError(t, err)
+	bf.building().filter.(*GenerationalBloomFilter).now = clock
+
+	first, second := createAddress(), createAddress()
+	require.NoError(t, bf.AddAddress(first))
+	now = now.Add(2 * day)
+	require.NoError(t, bf.AddAddress(second))
+	checkAddressesInBloomFilter(t, bf, []string{first, second})
+
+	// Both generations are saved in the file.
+	filePath := t.TempDir() + "/bloomfilter.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	loaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.NoError(t, err)
+	generational, ok := loaded.current.Load().filter.(*GenerationalBloomFilter)
+	require.True(t, ok, "Expected the header to select the generational backend")
+	generational.now = clock
+	require.Equal(t, 2, generational.Generations())
+	checkAddressesInBloomFilter(t, loaded, []string{first, second})
+
+	// The first address is matched for at least the TTL, and expires with its bucket.
+	now = time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	checkAddressesInBloomFilter(t, loaded, []string{first, second})
+	now = time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	found, err := loaded.CheckAddress(first)
+	require.NoError(t, err)
+	require.False(t, found, "Expected the first address to have expired")
+	checkAddressesInBloomFilter(t, loaded, []string{second})
+	require.Equal(t, 1, generational.Generations())
+	require.Equal(t, uint(1), loaded.Stats().Slices)
+
+	// Adding rotates the filter, dropping the expired generation.
+	third := createAddress()
+	require.NoError(t, bf.AddAddress(third))
+	require.Len(t, bf.current.Load().filter.(*GenerationalBloomFilter).generations, 2)
+	checkAddressesInBloomFilter(t, bf, []string{second, third})
+
+	now = now.Add(5 * day)
+	results := bf.CheckAddresses([]string{first, second, third})
+	for _, result := range results {
+		require.False(t, result.Found())
+	}
+}
+
+func TestGenerationalBloomFilterFull(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	f := NewGenerationalBloomFilter(2, 0.001, 4*24*time.Hour, 4)
+	f.now = func() time.Time { return now }
+
+	require.NoError(t, f.Add([]byte("first")))
+	require.NoError(t, f.Add([]byte("second")))
+	require.NoError(t, f.Add([]byte("first")), "Adding an element again does not take room")
+	require.ErrorIs(t, f.Add([]byte("third")), ErrFilterFull)
+	require.Equal(t, uint(2), f.Stats().ApproximateCount)
+
+	// The next bucket has room again, and an element added again is matched from it.
+	now = now.Add(24 * time.Hour)
+	inserted, err := f.Insert([]byte("first"))
+	require.NoError(t, err)
+	require.True(t, inserted)
+	require.NoError(t, f.Add([]byte("third")))
+}
+
+func TestGenerationalBloomFilterStoreExpiry(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	day := 24 * time.Hour
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	bf, err := NewBloomFilterStore(addressHandler, WithTTL(4*day, 4, 100, 0.001), WithExactMatch(), WithCommitment(), WithAddressInfo())
+	require.NoError(t, err)
+	bf.building().filter.(*GenerationalBloomFilter).now = func() time.Time { return now }
+
+	first, second := createAddress(), createAddress()
+	require.NoError(t, bf.AddAddress(first))
+	require.NoError(t, bf.AddAddressInfo(first, AddressInfo{Category: "mixer"}))
+	now = now.Add(2 * day)
+	require.NoError(t, bf.AddAddress(second))
+	require.NoError(t, bf.AddAddressInfo(second, AddressInfo{Category: "mixer"}))
+	require.Equal(t, uint64(2), bf.Metadata().ElementCount)
+
+	// Saving once the first address expired leaves it out of the exact tier, the commitment, the
+	// address info and the count.
+	now = now.Add(3 * day)
+	filePath := t.TempDir() + "/bloomfilter.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	require.Equal(t, uint64(1), bf.Metadata().ElementCount)
+	require.Equal(t, 1, bf.Commitment().Len())
+	s := bf.current.Load()
+	require.Equal(t, 1, s.exact.Len())
+	require.Len(t, s.info, 1)
+	info, err := bf.LookupAddress(second)
+	require.NoError(t, err)
+	require.Len(t, info, 1)
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"addressdb/address"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyTimeFormat is the sortable UTC timestamp starting the file name of each version.
+const historyTimeFormat = "20060102T150405.000000000Z"
+
+// historyCacheSize is the number of versions a History keeps loaded for queries.
+const historyCacheSize = 4
+
+// ErrNoVersion is returned when a History has no version at the requested time.
+var ErrNoVersion = errors.New("no version at the requested time")
+
+// Version is a filter recorded in a History.
+type Version struct {
+	Time     time.Time // When the version was recorded; it is in effect until the next one.
+	Checksum string    // Checksum of the version file, as returned by the Metadata of the store loaded from it.
+	Path     string    // File holding the version.
+}
+
+// RetentionPolicy selects the versions a History keeps. The latest version is always kept. A zero
+// policy keeps every version.
+type RetentionPolicy struct {
+	MaxVersions int           // Number of versions kept at most, 0 for no limit.
+	MaxAge      time.Duration // How far back queries are answered, 0 for no limit.
+	DailyAfter  time.Duration // Versions older than this are thinned to the last one of each UTC day, 0 to keep them all.
+}
+
+// apply splits versions, sorted by time, into the ones kept and the ones dropped at now.
+func (p RetentionPolicy) apply(versions []Version, now time.Time) (keep, drop []Version) {
+	kept := make([]bool, len(versions))
+	for i := range versions {
+		kept[i] = true
+	}
+	last := len(versions) - 1
+	for i, v := range versions[:max(last, 0)] {
+		next := versions[i+1]
+		switch {
+		case p.MaxAge > 0 && !next.Time.After(now.Add(-p.MaxAge)):
+			// Superseded before the oldest time queries are answered for.
+			kept[i] = false
+		case p.DailyAfter > 0 && v.Time.Before(now.Add(-p.DailyAfter)) && sameDay(v.Time, next.Time):
+			kept[i] = false
+		}
+	}
+	if p.MaxVersions > 0 {
+		for i, n := last, 0; i >= 0; i-- {
+			if kept[i] {
+				if n++; n > p.MaxVersions {
+					kept[i] = false
+				}
+			}
+		}
+	}
+
+	for i, v := range versions {
+		if kept[i] {
+			keep = append(keep, v)
+		} else {
+			drop = append(drop, v)
+		}
+	}
+	return keep, drop
+}
+
+// sameDay reports whether a and b fall on the same UTC day.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// History keeps timestamped versions of a filter in a directory, to check addresses against the
+// filter as it was at a given time. Each version is a filter file, with its address info next to it,
+// named after the time it was recorded and the checksum of the filter. Version files carry their own
+// checksum, verified when they are loaded.
+type History struct {
+	dir            string
+	addressHandler address.AddressHandler
+	opts           []Option // Applied when loading versions.
+	retention      RetentionPolicy
+	versions       []Version        // Sorted by time.
+	loaded         []*loadedVersion // Most recently used last.
+	mu             sync.Mutex
+}
+
+// loadedVersion is a version loaded for queries. Evicted versions are closed once no query uses them.
+type loadedVersion struct {
+	path    string
+	store   *BloomFilterStore
+	refs    int  // Queries using the store, guarded by the mutex of the History.
+	evicted bool // Dropped from the loaded versions.
+}
+
+// NewHistory opens the history kept in dir, creating the directory if needed. Versions are loaded
+// with addressHandler and opts, which must be able to read the stores added, e.g. hold the same
+// secure data handler and hash key.
+func NewHistory(dir string, addressHandler address.AddressHandler, retention RetentionPolicy, opts ...Option) (*History, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	h := &History{dir: dir, addressHandler: addressHandler, opts: opts, retention: retention}
+	for _, entry := range entries {
+		if v, ok := parseVersion(dir, entry.Name()); ok && entry.Type().IsRegular() {
+			h.versions = append(h.versions, v)
+		}
+	}
+	sort.Slice(h.versions, func(i, j int) bool {
+		return h.versions[i].Time.Before(h.versions[j].Time)
+	})
+	return h, nil
+}
+
+// parseVersion parses the name of a version file, <time>-<checksum>.gob.
+func parseVersion(dir, name string) (Version, bool) {
+	stem, ok := strings.CutSuffix(name, ".gob")
+	if !ok {
+		return Version{}, false
+	}
+	timestamp, checksum, _ := strings.Cut(stem, "-")
+	t, err := time.Parse(historyTimeFormat, timestamp)
+	if err != nil {
+		return Version{}, false
+	}
+	return Version{Time: t, Checksum: checksum, Path: filepath.Join(dir, name)}, true
+}
+
+// Versions returns the versions in the history, oldest first.
+func (h *History) Versions() []Version {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Version(nil), h.versions...)
+}
+
+// Add records the current filter of bf as the version in effect from at, then applies the retention
+// policy. The version is written with the build time of the filter, so recording an unchanged filter
+// gives the same checksum; nothing is recorded then if it is the version in effect at that time,
+// which is returned instead.
+func (h *History) Add(bf *BloomFilterStore, at time.Time) (Version, error) {
+	bf.mu.Lock()
+	err := bf.expire()
+	bf.mu.Unlock()
+	if err != nil {
+		return Version{}, err
+	}
+
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+
+	// The file is named after its checksum, known once it is written.
+	f, err := createAtomic(filepath.Join(h.dir, "version.gob"), "")
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to create version: %w", err)
+	}
+	defer f.Abort()
+	buildTime := s.metadata.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	saved, _, err := bf.writeTo(f, s, nil, s.info != nil, buildTime)
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to write version: %w", err)
+	}
+	v := Version{Time: at.UTC(), Checksum: saved.metadata.Checksum}
+	v.Path = filepath.Join(h.dir, v.Time.Format(historyTimeFormat)+"-"+v.Checksum+".gob")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := h.index(at); i >= 0 {
+		if h.versions[i].Checksum == v.Checksum {
+			return h.versions[i], nil
+		}
+		if h.versions[i].Time.Equal(at) {
+			return Version{}, fmt.Errorf("a version is already recorded at %s", at.UTC().Format(time.RFC3339Nano))
+		}
+	}
+
+	if saved.info != nil {
+		if err := bf.writeAddressInfo(AddressInfoPath(v.Path), "", saved); err != nil {
+			return Version{}, err
+		}
+	}
+	f.path = v.Path
+	if err := f.Commit(); err != nil {
+		return Version{}, fmt.Errorf("failed to write version: %w", err)
+	}
+
+	i := sort.Search(len(h.versions), func(i int) bool {
+		return h.versions[i].Time.After(v.Time)
+	})
+	h.versions = append(h.versions[:i], append([]Version{v}, h.versions[i:]...)...)
+	return v, h.prune(time.Now())
+}
+
+// Prune deletes the versions the retention policy drops at now.
+func (h *History) Prune(now time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.prune(now)
+}
+
+// prune implements Prune. The caller must hold h.mu.
+func (h *History) prune(now time.Time) error {
+	keep, drop := h.retention.apply(h.versions, now)
+	h.versions = keep
+	var errs []error
+	for _, v := range drop {
+		h.evict(v.Path)
+		for _, path := range []string{v.Path, AddressInfoPath(v.Path)} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// index returns the index of the version in effect at t, or -1 if there is none.
+func (h *History) index(t time.Time) int {
+	return sort.Search(len(h.versions), func(i int) bool {
+		return h.versions[i].Time.After(t)
+	}) - 1
+}
+
+// At returns the store holding the version in effect at t, i.e. the latest one recorded at or before
+// t, loading it if needed. It returns ErrNoVersion if t is before the first version. The store is
+// shared with other queries and must not be modified. release must be called once done with it, so
+// that the store can be closed once it is no longer loaded.
+func (h *History) At(t time.Time) (bf *BloomFilterStore, v Version, release func(), err error) {
+	h.mu.Lock()
+	i := h.index(t)
+	if i < 0 {
+		h.mu.Unlock()
+		return nil, Version{}, nil, fmt.Errorf("%w: %s", ErrNoVersion, t.UTC().Format(time.RFC3339))
+	}
+	v = h.versions[i]
+	loaded := h.acquire(v.Path)
+	h.mu.Unlock()
+	if loaded != nil {
+		return loaded.store, v, h.releaser(loaded), nil
+	}
+
+	// Versions are loaded without holding h.mu, so that loading one does not block other queries.
+	bf, err = NewBloomFilterStoreFromFile(v.Path, h.addressHandler, h.opts...)
+	if err != nil {
+		return nil, Version{}, nil, fmt.Errorf("failed to load version %s: %w", filepath.Base(v.Path), err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if loaded := h.acquire(v.Path); loaded != nil {
+		// Loaded by another query in the meantime.
+		bf.Close()
+		return loaded.store, v, h.releaser(loaded), nil
+	}
+	loaded = &loadedVersion{path: v.Path, store: bf, refs: 1}
+	if i := h.index(v.Time); i < 0 || h.versions[i].Path != v.Path {
+		// Pruned in the meantime: answer this query but do not keep it.
+		loaded.evicted = true
+		return bf, v, h.releaser(loaded), nil
+	}
+	if len(h.loaded) == historyCacheSize {
+		h.evict(h.loaded[0].path)
+	}
+	h.loaded = append(h.loaded, loaded)
+	return bf, v, h.releaser(loaded), nil
+}
+
+// acquire returns the loaded version at path, marking it most recently used and in use by one more
+// query, or nil if it is not loaded. The caller must hold h.mu.
+func (h *History) acquire(path string) *loadedVersion {
+	for j, loaded := range h.loaded {
+		if loaded.path == path {
+			h.loaded = append(append(h.loaded[:j:j], h.loaded[j+1:]...), loaded)
+			loaded.refs++
+			return loaded
+		}
+	}
+	return nil
+}
+
+// releaser returns the function a query calls once done with loaded, closing it if it was evicted
+// and no other query uses it.
+func (h *History) releaser(loaded *loadedVersion) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if loaded.refs--; loaded.refs == 0 && loaded.evicted {
+				loaded.store.Close()
+			}
+		})
+	}
+}
+
+// evict drops the loaded version at path, if any, closing its store unless a query still uses it.
+// The caller must hold h.mu.
+func (h *History) evict(path string) {
+	for j, loaded := range h.loaded {
+		if loaded.path == path {
+			h.loaded = append(h.loaded[:j:j], h.loaded[j+1:]...)
+			loaded.evicted = true
+			if loaded.refs == 0 {
+				loaded.store.Close()
+			}
+			return
+		}
+	}
+}
+
+// CheckAddressAt checks an address against the version in effect at t, see At and CheckAddress.
+func (h *History) CheckAddressAt(address string, t time.Time) (bool, error) {
+	bf, _, release, err := h.At(t)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return bf.CheckAddress(address)
+}
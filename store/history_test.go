@@ -0,0 +1,168 @@
+package store
+
+import (
+	"addressdb/address"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryCheckAddressAt(t *testing.T) {
+	dir := t.TempDir()
+	filePath := dir + "/bloomfilter.gob"
+	handler := &address.EVMAddressHandler{}
+	bf, err := NewBloomFilterStore(handler, WithEstimates(1000, 0.0001), WithExactMatch())
+	require.NoError(t, err)
+
+	history, err := NewHistory(dir+"/history", handler, RetentionPolicy{})
+	require.NoError(t, err)
+
+	march1 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	march5 := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	first, second := createAddress(), createAddress()
+
+	require.NoError(t, bf.AddAddress(first))
+	require.NoError(t, bf.SaveToFile(filePath))
+	v1, err := history.Add(bf, march1)
+	require.NoError(t, err)
+	// The version is named after the checksum of the file written.
+	loaded, _, release, err := history.At(march1)
+	require.NoError(t, err)
+	defer release()
+	require.Equal(t, loaded.Metadata().Checksum, v1.Checksum)
+	require.Contains(t, v1.Path, v1.Checksum)
+
+	// Recording an unchanged filter does not add a version.
+	same, err := history.Add(bf, march1.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, v1, same)
+
+	require.NoError(t, bf.AddAddress(second))
+	require.NoError(t, bf.SaveToFile(filePath))
+	_, err = history.Add(bf, march5)
+	require.NoError(t, err)
+	require.Len(t, history.Versions(), 2)
+
+	_, err = history.CheckAddressAt(first, march1.Add(-time.Hour))
+	require.ErrorIs(t, err, ErrNoVersion)
+	tests := []struct {
+		name    string
+		address string
+		at      time.Time
+		want    bool
+	}{
+		{"first on March 3rd", first, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), true},
+		{"second on March 3rd", second, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), false},
+		{"second on March 5th", second, march5, true},
+		{"second today", second, time.Now(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := history.CheckAddressAt(tt.address, tt.at)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, found)
+		})
+	}
+
+	// The versions are found again when the history is reopened.
+	reopened, err := NewHistory(dir+"/history", handler, RetentionPolicy{})
+	require.NoError(t, err)
+	require.Equal(t, history.Versions(), reopened.Versions())
+	found, err := reopened.CheckAddressAt(second, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestHistoryEvictMapped(t *testing.T) {
+	dir := t.TempDir()
+	handler := &address.EVMAddressHandler{}
+	history, err := NewHistory(dir, handler, RetentionPolicy{}, WithMmap())
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Hour)
+	addresses := make([]string, historyCacheSize+1)
+	for i := range addresses {
+		bf, err := NewBloomFilterStore(handler, WithEstimates(1000, 0.0001))
+		require.NoError(t, err)
+		addresses[i] = createAddress()
+		require.NoError(t, bf.AddAddress(addresses[i]))
+		_, err = history.Add(bf, start.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+	}
+
+	first, _, release, err := history.At(start)
+	require.NoError(t, err)
+	mapped := first.current.Load().filter.(*MappedBloomFilter)
+	for i := 1; i < len(addresses); i++ {
+		found, err := history.CheckAddressAt(addresses[i], start.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+		require.True(t, found)
+	}
+
+	// An evicted version stays mapped until the query using it is done.
+	found, err := first.CheckAddress(addresses[0])
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NotNil(t, mapped.mapping)
+	release()
+	require.Nil(t, mapped.mapping)
+
+	// It is loaded again for later queries.
+	found, err = history.CheckAddressAt(addresses[0], start)
+	require.NoError(t, err)
+	require.True(t, found)
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	at := func(d time.Duration) Version {
+		return Version{Time: now.Add(-d)}
+	}
+	versions := []Version{at(9 * day), at(5*day + time.Hour), at(5 * day), at(2 * day), at(time.Hour)}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []Version
+	}{
+		{"keep all", RetentionPolicy{}, versions},
+		{"max versions", RetentionPolicy{MaxVersions: 2}, versions[3:]},
+		// The version in effect 3 days ago is kept to answer queries for that time.
+		{"max age", RetentionPolicy{MaxAge: 3 * day}, versions[2:]},
+		{"daily", RetentionPolicy{DailyAfter: 4 * day}, []Version{versions[0], versions[2], versions[3], versions[4]}},
+		{"latest", RetentionPolicy{MaxAge: time.Minute}, versions[4:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, drop := tt.policy.apply(versions, now)
+			require.Equal(t, tt.want, keep)
+			require.Len(t, drop, len(versions)-len(tt.want))
+		})
+	}
+}
+
+func TestHistoryPrune(t *testing.T) {
+	dir := t.TempDir()
+	handler := &address.EVMAddressHandler{}
+	history, err := NewHistory(dir, handler, RetentionPolicy{MaxVersions: 2})
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		bf, err := NewBloomFilterStore(handler, WithEstimates(1000, 0.0001))
+		require.NoError(t, err)
+		require.NoError(t, bf.AddAddress(createAddress()))
+		require.NoError(t, bf.SaveToFile(dir+"/bloomfilter.gob"))
+		_, err = history.Add(bf, start.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+	}
+
+	versions := history.Versions()
+	require.Len(t, versions, 2)
+	require.Equal(t, start.Add(2*time.Minute).UTC(), versions[0].Time)
+	reopened, err := NewHistory(dir, handler, RetentionPolicy{})
+	require.NoError(t, err)
+	require.Equal(t, versions, reopened.Versions())
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"fmt"
+)
+
+// Merge returns a store holding the union of a and b: it matches every address matched by either
+// store. Both must be Bloom filters with the same size and number of hash functions, holding the
+// same address type hashed with the same key. The result keeps the address handler, hasher and
+// secure data handler of a, and opts are applied to it, e.g. to save it with another key.
+//
+// The exact tier, commitment and address info are kept if both stores have them.
+func Merge(a, b *BloomFilterStore, opts ...Option) (*BloomFilterStore, error) {
+	return combine(a, b, false, opts)
+}
+
+// Intersect returns a store holding the intersection of a and b: it matches the addresses matched
+// by both stores, see Merge for the requirements. Its false positive rate is at least that of a
+// filter built from the addresses in both stores, as bits set by different addresses may overlap.
+func Intersect(a, b *BloomFilterStore, opts ...Option) (*BloomFilterStore, error) {
+	return combine(a, b, true, opts)
+}
+
+// combine implements Merge and Intersect.
+func combine(a, b *BloomFilterStore, intersect bool, opts []Option) (*BloomFilterStore, error) {
+	// Each store is read once under its own lock, so that a store combined with itself or with a
+	// store being combined the other way round at the same time cannot deadlock.
+	sa, leavesA, err := a.frozen()
+	if err != nil {
+		return nil, err
+	}
+	sb, leavesB := sa, leavesA
+	if b != a {
+		if sb, leavesB, err = b.frozen(); err != nil {
+			return nil, err
+		}
+	}
+
+	left, ok := sa.filter.(*BloomFilter)
+	if !ok {
+		return nil, fmt.Errorf("only Bloom filters can be combined, got %q", sa.filter.Type())
+	}
+	right, ok := sb.filter.(*BloomFilter)
+	if !ok {
+		return nil, fmt.Errorf("only Bloom filters can be combined, got %q", sb.filter.Type())
+	}
+	if left.filter.Cap() != right.filter.Cap() || left.filter.K() != right.filter.K() {
+		return nil, fmt.Errorf("filters have different parameters: m=%d k=%d and m=%d k=%d",
+			left.filter.Cap(), left.filter.K(), right.filter.Cap(), right.filter.K())
+	}
+	if a.addressHandler.Type() != b.addressHandler.Type() {
+		return nil, fmt.Errorf("stores hold different address types: %q and %q", a.addressHandler.Type(), b.addressHandler.Type())
+	}
+	if a.hashKeyID() != b.hashKeyID() {
+		return nil, fmt.Errorf("stores are keyed with different keys: %q and %q", a.hashKeyID(), b.hashKeyID())
+	}
+
+	filter := &BloomFilter{filter: left.filter.Copy()}
+	if intersect {
+		filter.filter.BitSet().InPlaceIntersection(right.filter.BitSet())
+	} else if err := filter.filter.Merge(right.filter); err != nil {
+		return nil, err
+	}
+
+	bf := &BloomFilterStore{
+		addressHandler:    a.addressHandler,
+		secureDataHandler: a.secureDataHandler,
+		hasher:            a.hasher,
+	}
+	s := &snapshot{
+		filter: filter,
+		metadata: Metadata{
+			AddressType:       sa.metadata.AddressType,
+			Capacity:          sa.metadata.Capacity,
+			FalsePositiveRate: sa.metadata.FalsePositiveRate,
+			KeyID:             sa.metadata.KeyID,
+		},
+		mutable: true,
+	}
+	bf.publish(s)
+	if sa.exact != nil && sb.exact != nil {
+		s.exact = combineExact(sa.exact, sb.exact, intersect)
+		s.metadata.Exact = true
+	}
+	if leavesA != nil && leavesB != nil {
+		bf.leaves = combineKeys(leavesA, leavesB, intersect)
+	}
+	if sa.info != nil && sb.info != nil {
+		s.info = make(addressInfoSet)
+		for _, set := range []addressInfoSet{sa.info, sb.info} {
+			for key, entries := range set {
+				if intersect && !bf.testBytes(s, []byte(key)) {
+					continue
+				}
+				for _, info := range entries {
+					s.info.add([]byte(key), info)
+				}
+			}
+		}
+	}
+
+	if s.exact != nil {
+		s.metadata.ElementCount = uint64(s.exact.Len())
+	} else {
+		s.metadata.ElementCount = uint64(filter.filter.ApproximatedSize())
+	}
+
+	for _, opt := range opts {
+		opt(bf)
+	}
+	return bf, nil
+}
+
+// testBytes reports whether the filter of s matches address bytes, hashing them first if the store
+// is keyed.
+func (bf *BloomFilterStore) testBytes(s *snapshot, addressBytes []byte) bool {
+	key, err := bf.hashAddress(addressBytes)
+	return err == nil && s.filter.Test(key)
+}
+
+// combineExact returns the union or intersection of two exact sets.
+func combineExact(a, b *exactSet, intersect bool) *exactSet {
+	keys := func(s *exactSet) map[string]struct{} {
+		m := make(map[string]struct{}, s.Len())
+		for _, key := range s.sorted {
+			m[string(key)] = struct{}{}
+		}
+		for key := range s.pending {
+			m[key] = struct{}{}
+		}
+		return m
+	}
+	set := newExactSet()
+	for key := range combineKeys(keys(a), keys(b), intersect) {
+		set.Add([]byte(key))
+	}
+	set.compact()
+	return set
+}
+
+// combineKeys returns the union or intersection of two key sets.
+func combineKeys(a, b map[string]struct{}, intersect bool) map[string]struct{} {
+	result := make(map[string]struct{})
+	for key := range a {
+		if _, ok := b[key]; ok || !intersect {
+			result[key] = struct{}{}
+		}
+	}
+	if !intersect {
+		for key := range b {
+			result[key] = struct{}{}
+		}
+	}
+	return result
+}
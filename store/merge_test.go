@@ -0,0 +1,113 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeAndIntersect(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	shared, onlyA, onlyB := createAddress(), createAddress(), createAddress()
+
+	a, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithExactMatch())
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, a, []string{shared, onlyA})
+	b, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithExactMatch())
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, b, []string{shared, onlyB})
+
+	union, err := Merge(a, b)
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, union, []string{shared, onlyA, onlyB})
+	require.Equal(t, uint64(3), union.Metadata().ElementCount)
+
+	intersection, err := Intersect(a, b)
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, intersection, []string{shared})
+	for _, address := range []string{onlyA, onlyB} {
+		found, err := intersection.CheckAddress(address)
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+	require.Equal(t, uint64(1), intersection.Metadata().ElementCount)
+
+	// The inputs are unchanged.
+	found, err := a.CheckAddress(onlyB)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// A store can be combined with itself, also while it is being written to.
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			err = a.AddAddress(createAddress())
+		}
+		done <- err
+	}()
+	for i := 0; i < 20; i++ {
+		self, err := Merge(a, a)
+		require.NoError(t, err)
+		checkAddressesInBloomFilter(t, self, []string{shared, onlyA})
+	}
+	require.NoError(t, <-done)
+}
+
+func TestMergeEncrypted(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	var paths []string
+	var addresses []string
+	for _, name := range []string{"a", "b"} {
+		address := createAddress()
+		bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithSecureDataHandler(aliceWriter), WithHashKey([]byte("key")))
+		require.NoError(t, err)
+		addAddressesToBloomFilter(t, bf, []string{address})
+		path := os.TempDir() + "/bloomfilter-merge-" + name + ".gob"
+		require.NoError(t, bf.SaveToFile(path))
+		defer os.Remove(path)
+		paths = append(paths, path)
+		addresses = append(addresses, address)
+	}
+
+	a := mustLoad(t, paths[0], addressHandler, WithSecureDataHandler(bobReader), WithHashKey([]byte("key")))
+	b := mustLoad(t, paths[1], addressHandler, WithSecureDataHandler(bobReader), WithHashKey([]byte("key")))
+	union, err := Merge(a, b, WithSecureDataHandler(aliceWriter), WithSource("merged"))
+	require.NoError(t, err)
+	outPath := os.TempDir() + "/bloomfilter-merged.gob"
+	require.NoError(t, union.SaveToFile(outPath))
+	defer os.Remove(outPath)
+
+	merged := mustLoad(t, outPath, addressHandler, WithSecureDataHandler(bobReader), WithHashKey([]byte("key")))
+	checkAddressesInBloomFilter(t, merged, addresses)
+	require.Equal(t, "merged", merged.Metadata().Source)
+	require.True(t, merged.Metadata().Encrypted)
+}
+
+func TestMergeIncompatible(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	small, err := NewBloomFilterStore(addressHandler, WithEstimates(100, 0.01))
+	require.NoError(t, err)
+	large, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.01))
+	require.NoError(t, err)
+	keyed, err := NewBloomFilterStore(addressHandler, WithEstimates(100, 0.01), WithHashKey([]byte("key")))
+	require.NoError(t, err)
+	cuckoo, err := NewBloomFilterStore(addressHandler, WithFilter(NewCuckooFilter(100)))
+	require.NoError(t, err)
+
+	_, err = Merge(small, large)
+	require.Error(t, err)
+	_, err = Intersect(small, keyed)
+	require.Error(t, err)
+	_, err = Merge(small, cuckoo)
+	require.Error(t, err)
+}
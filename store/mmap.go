@@ -0,0 +1,186 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"runtime"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// bloomHeaderSize is the size of the m, k and bit length fields preceding the words of a
+// serialized bloom.BloomFilter.
+const bloomHeaderSize = 24
+
+// MappedBloomFilter implements Filter on a Bloom filter file mapped in memory, testing bits in the
+// mapping instead of copying them onto the heap. It is read-only: Add fails with ErrImmutableFilter.
+// The mapping is released once the filter is garbage collected, as queries may still use a filter
+// replaced by a reload, or by Close.
+type MappedBloomFilter struct {
+	mapping []byte // The whole file.
+	words   []byte // The big-endian bitset words of the filter, within mapping.
+	m, k    uint64
+}
+
+// WithMmap makes LoadFromFile map unencrypted Bloom filter files in memory instead of reading
+// them, see MappedBloomFilter. Loading takes constant time, and reloads swap mappings without
+// copying the filter; the checksum is not verified, as that would read the whole file. Mapped
+// filters are read-only, so deltas cannot be applied to them. Files that are encrypted, use another
+// backend or have an exact tier are loaded as usual.
+func WithMmap() Option {
+	return func(bf *BloomFilterStore) {
+		bf.mmap = true
+	}
+}
+
+// mapFilterFile maps the Bloom filter in filePath. It returns a nil filter, and no error, if the
+// file cannot be mapped and must be read instead.
+func (bf *BloomFilterStore) mapFilterFile(filePath string) (*MappedBloomFilter, *Metadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	prefix := make([]byte, len(formatMagic))
+	if _, err := io.ReadFull(f, prefix); err != nil || !isVersioned(prefix) {
+		return nil, nil, nil // Legacy files are read with the current backend.
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	metadata, header, err := readHeader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata.Encrypted || bf.secureDataHandler != nil || metadata.FilterType != BloomFilterType || metadata.Exact {
+		return nil, nil, nil
+	}
+	if err := bf.checkMetadata(metadata); err != nil {
+		return nil, nil, err
+	}
+
+	mapping, err := mmapFile(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to map file: %w", err)
+	}
+	filter, err := newMappedBloomFilter(mapping, len(header))
+	if err != nil {
+		munmap(mapping)
+		return nil, nil, err
+	}
+	metadata.Checksum = hex.EncodeToString(mapping[len(mapping)-sha256.Size:])
+	return filter, metadata, nil
+}
+
+// newMappedBloomFilter parses the serialized Bloom filter starting at offset in mapping, followed
+// by the checksum of the file.
+func newMappedBloomFilter(mapping []byte, offset int) (*MappedBloomFilter, error) {
+	if len(mapping) < offset+bloomHeaderSize+sha256.Size {
+		return nil, errors.New("file too short for a Bloom filter")
+	}
+	filterHeader := mapping[offset : offset+bloomHeaderSize]
+	f := &MappedBloomFilter{
+		mapping: mapping,
+		m:       binary.BigEndian.Uint64(filterHeader[0:]),
+		k:       binary.BigEndian.Uint64(filterHeader[8:]),
+	}
+	length := binary.BigEndian.Uint64(filterHeader[16:])
+	if f.m == 0 || f.k == 0 || length != f.m {
+		return nil, fmt.Errorf("invalid Bloom filter parameters: m=%d k=%d length=%d", f.m, f.k, length)
+	}
+	start := uint64(offset + bloomHeaderSize)
+	size := (f.m + 63) / 64 * 8
+	if start+size+sha256.Size != uint64(len(mapping)) {
+		return nil, fmt.Errorf("file size %d does not match a Bloom filter of %d bits", len(mapping), f.m)
+	}
+	f.words = mapping[start : start+size]
+	runtime.SetFinalizer(f, (*MappedBloomFilter).Close)
+	return f, nil
+}
+
+// Add fails with ErrImmutableFilter.
+func (f *MappedBloomFilter) Add([]byte) error {
+	return ErrImmutableFilter
+}
+
+// Test reports whether data is possibly in the filter.
+func (f *MappedBloomFilter) Test(data []byte) bool {
+	for _, location := range bloom.Locations(data, uint(f.k)) {
+		i := location % f.m
+		word := binary.BigEndian.Uint64(f.words[i/64*8:])
+		if word&(1<<(i%64)) == 0 {
+			runtime.KeepAlive(f)
+			return false
+		}
+	}
+	runtime.KeepAlive(f) // The mapping must outlive the reads of f.words.
+	return true
+}
+
+// WriteTo writes the filter to w, in the format of BloomFilter.
+func (f *MappedBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	var header [bloomHeaderSize]byte
+	binary.BigEndian.PutUint64(header[0:], f.m)
+	binary.BigEndian.PutUint64(header[8:], f.k)
+	binary.BigEndian.PutUint64(header[16:], f.m)
+	n, err := w.Write(header[:])
+	if err != nil {
+		return int64(n), err
+	}
+	written, err := io.Copy(w, bytes.NewReader(f.words))
+	runtime.KeepAlive(f)
+	return int64(n) + written, err
+}
+
+// ReadFrom fails, mapped filters are loaded with LoadFromFile.
+func (f *MappedBloomFilter) ReadFrom(io.Reader) (int64, error) {
+	return 0, errors.New("mapped filters cannot be read from a stream")
+}
+
+// Type returns BloomFilterType, as the filter is stored like a BloomFilter.
+func (f *MappedBloomFilter) Type() string {
+	return BloomFilterType
+}
+
+// Stats returns the parameters, fill and approximate element count of the filter. It counts the
+// bits set, reading the whole mapping.
+func (f *MappedBloomFilter) Stats() FilterStats {
+	var set uint
+	for i := 0; i < len(f.words); i += 8 {
+		set += uint(bits.OnesCount64(binary.BigEndian.Uint64(f.words[i:])))
+	}
+	runtime.KeepAlive(f)
+	m, k := float64(f.m), float64(f.k)
+	// The estimate is infinite once every bit is set; report the one for all bits but one instead.
+	fill := min(float64(set), m-1) / m
+	stats := FilterStats{
+		Type:             BloomFilterType,
+		Capacity:         uint(f.m),
+		HashFunctions:    uint(f.k),
+		BitsSet:          set,
+		ApproximateCount: uint(math.Floor(-m/k*math.Log(1-fill) + 0.5)),
+	}
+	stats.FillRatio = float64(set) / m
+	stats.EstimatedFalsePositiveRate = math.Pow(stats.FillRatio, k)
+	return stats
+}
+
+// Close releases the mapping. The filter must not be used afterwards.
+func (f *MappedBloomFilter) Close() error {
+	if f.mapping == nil {
+		return nil
+	}
+	runtime.SetFinalizer(f, nil)
+	err := munmap(f.mapping)
+	f.mapping, f.words = nil, nil
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package store
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the whole file, on platforms without mmap support.
+func mmapFile(f *os.File) ([]byte, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+// munmap does nothing, the data read by mmapFile is garbage collected.
+func munmap([]byte) error {
+	return nil
+}
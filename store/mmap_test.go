@@ -0,0 +1,112 @@
+package store
+
+import (
+	"addressdb/address"
+	"addressdb/securedata"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedBloomFilter(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "bloomfilter.gob")
+
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithHashKey([]byte("key")))
+	require.NoError(t, err)
+	addresses := []string{createAddress(), createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	mapped := mustLoad(t, filePath, addressHandler, WithMmap(), WithHashKey([]byte("key")))
+	require.IsType(t, &MappedBloomFilter{}, mapped.current.Load().filter)
+	checkAddressesInBloomFilter(t, mapped, addresses)
+	found, err := mapped.CheckAddress(createAddress())
+	require.NoError(t, err)
+	require.False(t, found)
+
+	loaded := mustLoad(t, filePath, addressHandler, WithHashKey([]byte("key")))
+	require.Equal(t, loaded.Metadata(), mapped.Metadata())
+	require.Equal(t, loaded.Stats(), mapped.Stats())
+	require.ErrorIs(t, mapped.AddAddress(createAddress()), ErrImmutableFilter)
+
+	// A mapped filter is saved in the format of a BloomFilter.
+	copyPath := filepath.Join(dir, "copy.gob")
+	require.NoError(t, mapped.SaveToFile(copyPath))
+	checkAddressesInBloomFilter(t, mustLoad(t, copyPath, addressHandler, WithHashKey([]byte("key"))), addresses)
+
+	// Reloading swaps the mapping.
+	added := createAddress()
+	addAddressesToBloomFilter(t, bf, []string{added})
+	require.NoError(t, bf.SaveToFile(filePath))
+	require.NoError(t, mapped.LoadFromFile(filePath))
+	require.IsType(t, &MappedBloomFilter{}, mapped.current.Load().filter)
+	checkAddressesInBloomFilter(t, mapped, append(addresses, added))
+	require.NoError(t, mapped.Close())
+}
+
+func TestMappedBloomFilterStatsFull(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{}, WithEstimates(1, 0.5))
+	require.NoError(t, err)
+	for i := 0; bf.Stats().FillRatio < 1; i++ {
+		require.Less(t, i, 10000)
+		require.NoError(t, bf.AddAddress(createAddress()))
+	}
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	mapped := mustLoad(t, filePath, &address.EVMAddressHandler{}, WithMmap())
+	stats := mapped.Stats()
+	require.Equal(t, stats.Capacity, stats.BitsSet)
+	require.Positive(t, stats.ApproximateCount)
+	require.Less(t, stats.ApproximateCount, uint(1000))
+}
+
+func TestMappedBloomFilterFallback(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		writer []Option
+		reader []Option
+	}{
+		{"encrypted", []Option{WithEstimates(1000, 0.001), WithSecureDataHandler(aliceWriter)}, []Option{WithSecureDataHandler(bobReader)}},
+		{"exact", []Option{WithEstimates(1000, 0.001), WithExactMatch()}, nil},
+		{"cuckoo", []Option{WithFilter(NewCuckooFilter(1000))}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bf, err := NewBloomFilterStore(addressHandler, tt.writer...)
+			require.NoError(t, err)
+			address := createAddress()
+			addAddressesToBloomFilter(t, bf, []string{address})
+			filePath := filepath.Join(dir, tt.name+".gob")
+			require.NoError(t, bf.SaveToFile(filePath))
+
+			loaded := mustLoad(t, filePath, addressHandler, append(tt.reader, WithMmap())...)
+			_, mapped := loaded.current.Load().filter.(*MappedBloomFilter)
+			require.False(t, mapped)
+			checkAddressesInBloomFilter(t, loaded, []string{address})
+		})
+	}
+
+	// Truncated files are rejected.
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	filePath := filepath.Join(dir, "truncated.gob")
+	require.NoError(t, bf.SaveToFile(filePath))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(filePath, info.Size()-8))
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler, WithMmap())
+	require.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MultiStore holds several named BloomFilterStores, e.g. one per list category, and checks
+// addresses against all of them at once.
+type MultiStore struct {
+	stores map[string]*BloomFilterStore
+	mu     sync.RWMutex
+}
+
+// NewMultiStore creates an empty MultiStore.
+func NewMultiStore() *MultiStore {
+	return &MultiStore{stores: make(map[string]*BloomFilterStore)}
+}
+
+// Set adds a store under label, replacing any store previously registered with that label.
+func (m *MultiStore) Set(label string, store *BloomFilterStore) error {
+	if label == "" {
+		return fmt.Errorf("store label cannot be empty")
+	}
+	if store == nil {
+		return fmt.Errorf("store %q cannot be nil", label)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stores[label] = store
+	return nil
+}
+
+// Remove deletes the store registered under label.
+func (m *MultiStore) Remove(label string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.stores, label)
+}
+
+// Store returns the store registered under label.
+func (m *MultiStore) Store(label string) (*BloomFilterStore, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	store, ok := m.stores[label]
+	return store, ok
+}
+
+// Labels returns the labels of all stores, sorted.
+func (m *MultiStore) Labels() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	labels := make([]string, 0, len(m.stores))
+	for label := range m.stores {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// CheckAddress checks an address against every store and returns the sorted labels of the stores
+// that possibly contain it. Stores whose address handler rejects the address are skipped; an error
+// is returned only if every store rejects it.
+func (m *MultiStore) CheckAddress(address string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matches := make([]string, 0)
+	var lastErr error
+	checked := 0
+	for label, store := range m.stores {
+		found, err := store.CheckAddress(address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		checked++
+		if found {
+			matches = append(matches, label)
+		}
+	}
+	if checked == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// CheckAddresses checks addresses like CheckAddress, using the batch check of every store. It
+// returns the matching labels and the error of each address, in the order of addresses.
+func (m *MultiStore) CheckAddresses(addresses []string) ([][]string, []error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	labels := make([]string, 0, len(m.stores))
+	for label := range m.stores {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	matches := make([][]string, len(addresses))
+	errs := make([]error, len(addresses))
+	checked := make([]int, len(addresses))
+	for i := range matches {
+		matches[i] = make([]string, 0)
+	}
+	for _, label := range labels {
+		for i, result := range m.stores[label].CheckAddresses(addresses) {
+			if result.Err != nil {
+				errs[i] = result.Err
+				continue
+			}
+			checked[i]++
+			if result.Found() {
+				matches[i] = append(matches[i], label)
+			}
+		}
+	}
+	for i := range addresses {
+		if checked[i] > 0 {
+			errs[i] = nil
+		} else if errs[i] != nil {
+			matches[i] = nil
+		}
+	}
+	return matches, errs
+}
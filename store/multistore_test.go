@@ -0,0 +1,61 @@
+package store
+
+import (
+	"addressdb/address"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestMultiStoreCheckAddress(t *testing.T) {
+	evmHandler := &address.EVMAddressHandler{}
+
+	sanctions, err := NewBloomFilterStore(evmHandler)
+	require.NoError(t, err)
+	mixers, err := NewBloomFilterStore(evmHandler)
+	require.NoError(t, err)
+	bitcoin, err := NewBloomFilterStore(&address.BitcoinAddressHandler{})
+	require.NoError(t, err)
+
+	sanctioned, mixer, both, clean := createAddress(), createAddress(), createAddress(), createAddress()
+	addAddressesToBloomFilter(t, sanctions, []string{sanctioned, both})
+	addAddressesToBloomFilter(t, mixers, []string{mixer, both})
+
+	multi := NewMultiStore()
+	require.NoError(t, multi.Set("sanctions", sanctions))
+	require.NoError(t, multi.Set("mixers", mixers))
+	require.NoError(t, multi.Set("bitcoin", bitcoin))
+	require.Error(t, multi.Set("", sanctions))
+	require.Equal(t, []string{"bitcoin", "mixers", "sanctions"}, multi.Labels())
+
+	tests := []struct {
+		name    string
+		address string
+		want    []string
+	}{
+		{"sanctioned", sanctioned, []string{"sanctions"}},
+		{"mixer", mixer, []string{"mixers"}},
+		{"both", both, []string{"mixers", "sanctions"}},
+		{"clean", clean, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := multi.CheckAddress(tt.address)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = multi.CheckAddress("not an address")
+	require.Error(t, err, "Expected error when no store accepts the address")
+
+	matches, errs := multi.CheckAddresses([]string{sanctioned, both, clean, "not an address"})
+	require.Equal(t, [][]string{{"sanctions"}, {"mixers", "sanctions"}, {}, nil}, matches)
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[2])
+	require.Error(t, errs[3], "Expected error when no store accepts the address")
+
+	multi.Remove("sanctions")
+	got, err := multi.CheckAddress(both)
+	require.NoError(t, err)
+	require.Equal(t, []string{"mixers"}, got)
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// PlanRates are the false positive rates listed by PlanTable when none are given.
+var PlanRates = []float64{1e-2, 1e-3, 1e-4, 1e-5, 1e-6, 1e-7, 1e-8, 1e-9}
+
+// PlanMaxHashFunctions bounds the number of hash functions of filters sized by PlanForSize, reached
+// at a false positive rate of about 2e-10.
+const PlanMaxHashFunctions = 32
+
+// Plan is the size of a Bloom filter for an expected number of elements.
+type Plan struct {
+	Count             uint    `json:"count"`               // Expected number of elements.
+	Bits              uint    `json:"bits"`                // Size of the filter (m).
+	HashFunctions     uint    `json:"hash_functions"`      // Number of hash functions (k).
+	FileSize          int64   `json:"file_size"`           // Approximate size in bytes of an unencrypted file.
+	FalsePositiveRate float64 `json:"false_positive_rate"` // Expected false positive rate once Count elements are added.
+}
+
+// PlanForRate sizes a Bloom filter for count elements at falsePositiveRate, as WithEstimates does.
+func PlanForRate(count uint, falsePositiveRate float64) (Plan, error) {
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return Plan{}, fmt.Errorf("false positive rate must be between 0 and 1, got %g", falsePositiveRate)
+	}
+	count = max(count, 1)
+	m, k := bloom.EstimateParameters(count, falsePositiveRate)
+	return newPlan(count, max(m, 1), max(k, 1)), nil
+}
+
+// PlanForSize sizes the largest Bloom filter for count elements whose file fits in maxBytes, with
+// the number of hash functions minimizing its false positive rate. The filter is not made larger
+// than needs PlanMaxHashFunctions, so that a small list in a large size does not hash each element
+// an unbounded number of times.
+func PlanForSize(count uint, maxBytes int64) (Plan, error) {
+	count = max(count, 1)
+	words := (maxBytes - planOverhead(count)) / 8
+	if words < 1 {
+		return Plan{}, fmt.Errorf("%d bytes cannot hold a filter file, it needs at least %d", maxBytes, planOverhead(count)+8)
+	}
+	maxWords := int64(PlanMaxHashFunctions * float64(count) / math.Ln2 / 64)
+	m := uint(max(min(words, maxWords), 1)) * 64
+	k := uint(math.Round(float64(m) / float64(count) * math.Ln2))
+	return newPlan(count, m, min(max(k, 1), PlanMaxHashFunctions)), nil
+}
+
+// PlanTable returns the plans for count elements at each of the given false positive rates, or at
+// PlanRates if none are given.
+func PlanTable(count uint, rates ...float64) ([]Plan, error) {
+	if len(rates) == 0 {
+		rates = PlanRates
+	}
+	plans := make([]Plan, 0, len(rates))
+	for _, rate := range rates {
+		plan, err := PlanForRate(count, rate)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// newPlan completes a plan for count elements in m bits with k hash functions.
+func newPlan(count, m, k uint) Plan {
+	plan := Plan{Count: count, Bits: m, HashFunctions: k}
+	plan.FalsePositiveRate = plan.RateAt(count)
+	plan.FileSize = planOverhead(count) + 8*int64((m+63)/64)
+	return plan
+}
+
+// RateAt returns the expected false positive rate of the planned filter holding count elements,
+// (1 - e^(-kn/m))^k.
+func (p Plan) RateAt(count uint) float64 {
+	return math.Pow(1-math.Exp(-float64(p.HashFunctions)*float64(count)/float64(p.Bits)), float64(p.HashFunctions))
+}
+
+// WithPlan backs the store with a Bloom filter of the size and number of hash functions of plan.
+func WithPlan(p Plan) Option {
+	return func(bf *BloomFilterStore) {
+		s := bf.building()
+		s.filter = &BloomFilter{filter: bloom.New(p.Bits, p.HashFunctions)}
+		s.metadata.Capacity = p.Count
+		s.metadata.FalsePositiveRate = p.FalsePositiveRate
+	}
+}
+
+// planOverhead returns the bytes of a filter file besides the bits of the filter: the header, as
+// written for an EVM list without source label, the parameters of the filter and the checksum.
+func planOverhead(count uint) int64 {
+	metadata := Metadata{
+		Version:           FormatVersion,
+		FilterType:        BloomFilterType,
+		AddressType:       "evm",
+		BuildTime:         time.Date(2000, 1, 1, 0, 0, 0, 123456789, time.UTC),
+		Capacity:          count,
+		FalsePositiveRate: 1.2345678901234567e-10,
+		ElementCount:      uint64(count),
+	}
+	var header bytes.Buffer
+	writeHeader(&header, &metadata)
+	return int64(header.Len()) + 3*8 + 32
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"addressdb/address"
+	"os"
+	"testing"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanForRate(t *testing.T) {
+	plan, err := PlanForRate(1000, 0.001)
+	require.NoError(t, err)
+	m, k := bloom.EstimateParameters(1000, 0.001)
+	require.Equal(t, m, plan.Bits)
+	require.Equal(t, k, plan.HashFunctions)
+	require.InDelta(t, 0.001, plan.FalsePositiveRate, 0.0002)
+	require.Greater(t, plan.RateAt(2000), plan.FalsePositiveRate)
+
+	// The planned size is that of the file saved with the planned filter.
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{}, WithPlan(plan))
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, bf.AddAddress(createAddress()))
+	}
+	filePath := t.TempDir() + "/bloomfilter.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	require.InDelta(t, plan.FileSize, info.Size(), 16)
+
+	_, err = PlanForRate(1000, 0)
+	require.Error(t, err)
+}
+
+func TestPlanForSize(t *testing.T) {
+	small, err := PlanForSize(20000, 4096)
+	require.NoError(t, err)
+	large, err := PlanForSize(20000, 64*1024)
+	require.NoError(t, err)
+	require.LessOrEqual(t, small.FileSize, int64(4096))
+	require.LessOrEqual(t, large.FileSize, int64(64*1024))
+	require.Greater(t, large.FileSize, int64(64*1024-8))
+	require.Less(t, large.FalsePositiveRate, small.FalsePositiveRate)
+
+	// A size planned for a rate is found again from its file size.
+	planned, err := PlanForRate(10000, 1e-6)
+	require.NoError(t, err)
+	fitted, err := PlanForSize(10000, planned.FileSize)
+	require.NoError(t, err)
+	require.InDelta(t, planned.Bits, fitted.Bits, 64)
+	require.InDelta(t, planned.FalsePositiveRate, fitted.FalsePositiveRate, 1e-7)
+
+	_, err = PlanForSize(10000, 100)
+	require.Error(t, err)
+
+	// A small list in a large size gets no more hash functions than PlanMaxHashFunctions.
+	capped, err := PlanForSize(3, 1<<30)
+	require.NoError(t, err)
+	require.LessOrEqual(t, capped.HashFunctions, uint(PlanMaxHashFunctions))
+	require.Less(t, capped.FileSize, int64(1024))
+
+	table, err := PlanTable(10000)
+	require.NoError(t, err)
+	require.Len(t, table, len(PlanRates))
+	for i := 1; i < len(table); i++ {
+		require.Greater(t, table[i].FileSize, table[i-1].FileSize)
+	}
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/bits-and-blooms/bloom/v3"
+)
+
+// ScalableBloomFilterType is the name of the scalable Bloom filter backend.
+const ScalableBloomFilterType = "scalable-bloom"
+
+const (
+	scalableTightness = 0.9 // False positive rate multiplier of each new slice.
+	scalableMaxSlices = 64
+)
+
+func init() {
+	RegisterFilter(ScalableBloomFilterType, func() Filter { return &ScalableBloomFilter{} })
+}
+
+// ScalableBloomFilter implements Filter with a series of Bloom filter slices. When the current
+// slice reaches its capacity a new slice is added, twice as large and with a tighter false
+// positive rate, so the overall rate stays below the target however many elements are added.
+type ScalableBloomFilter struct {
+	capacity          uint    // Capacity of the first slice.
+	falsePositiveRate float64 // Target false positive rate of the whole filter.
+	slices            []scalableSlice
+}
+
+type scalableSlice struct {
+	filter   *bloom.BloomFilter
+	capacity uint
+	count    uint
+}
+
+// NewScalableBloomFilter creates a scalable Bloom filter whose first slice holds capacity elements,
+// keeping the overall false positive rate below falsePositiveRate as it grows.
+func NewScalableBloomFilter(capacity uint, falsePositiveRate float64) *ScalableBloomFilter {
+	f := &ScalableBloomFilter{
+		capacity:          max(capacity, 1),
+		falsePositiveRate: falsePositiveRate,
+	}
+	f.grow() // The first slice cannot overflow.
+	return f
+}
+
+// grow appends a slice. Slice i has capacity c*2^i and false positive rate p*(1-r)*r^i, so the
+// rates of all slices sum to at most p. It returns ErrFilterFull if the capacity overflows.
+func (f *ScalableBloomFilter) grow() error {
+	i := len(f.slices)
+	if i >= scalableMaxSlices {
+		return ErrFilterFull
+	}
+	capacity := f.capacity << i
+	if capacity>>i != f.capacity {
+		return ErrFilterFull
+	}
+	falsePositiveRate := f.falsePositiveRate * (1 - scalableTightness) * math.Pow(scalableTightness, float64(i))
+	f.slices = append(f.slices, scalableSlice{
+		filter:   bloom.NewWithEstimates(capacity, falsePositiveRate),
+		capacity: capacity,
+	})
+	return nil
+}
+
+// Add inserts data into the filter, adding a slice if the current one is full.
+func (f *ScalableBloomFilter) Add(data []byte) error {
+	_, err := f.Insert(data)
+	return err
+}
+
+// Insert inserts data into the filter like Add, reporting whether it was inserted. Elements that
+// test as present, including false positives, are not inserted again so that they do not count
+// towards capacity.
+func (f *ScalableBloomFilter) Insert(data []byte) (bool, error) {
+	if f.Test(data) {
+		return false, nil
+	}
+
+	last := &f.slices[len(f.slices)-1]
+	if last.count >= last.capacity {
+		if err := f.grow(); err != nil {
+			return false, err
+		}
+		last = &f.slices[len(f.slices)-1]
+	}
+
+	last.filter.Add(data)
+	last.count++
+	return true, nil
+}
+
+// Test reports whether data is possibly in any slice of the filter.
+func (f *ScalableBloomFilter) Test(data []byte) bool {
+	for _, slice := range f.slices {
+		if slice.filter.Test(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Slices returns the number of slices the filter has grown to.
+func (f *ScalableBloomFilter) Slices() int {
+	return len(f.slices)
+}
+
+// WriteTo writes the filter to w.
+func (f *ScalableBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := []uint64{uint64(f.capacity), math.Float64bits(f.falsePositiveRate), uint64(len(f.slices))}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	for _, slice := range f.slices {
+		if err := binary.Write(w, binary.BigEndian, []uint64{uint64(slice.capacity), uint64(slice.count)}); err != nil {
+			return n, err
+		}
+		n += 16
+		written, err := slice.filter.WriteTo(w)
+		n += written
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads the filter from r.
+func (f *ScalableBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(r, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	if header[2] == 0 || header[2] > scalableMaxSlices {
+		return n, errors.New("invalid scalable Bloom filter: bad slice count")
+	}
+
+	slices := make([]scalableSlice, header[2])
+	for i := range slices {
+		sliceHeader := make([]uint64, 2)
+		if err := binary.Read(r, binary.BigEndian, sliceHeader); err != nil {
+			return n, err
+		}
+		n += 16
+		slices[i] = scalableSlice{filter: &bloom.BloomFilter{}, capacity: uint(sliceHeader[0]), count: uint(sliceHeader[1])}
+		read, err := slices[i].filter.ReadFrom(r)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+
+	f.capacity = uint(header[0])
+	f.falsePositiveRate = math.Float64frombits(header[1])
+	f.slices = slices
+	return n, nil
+}
+
+// Type returns ScalableBloomFilterType.
+func (f *ScalableBloomFilter) Type() string {
+	return ScalableBloomFilterType
+}
+
+// Stats returns the totals over all slices. HashFunctions is that of the newest slice, and the
+// estimated false positive rate is the chance that any slice reports a false positive.
+func (f *ScalableBloomFilter) Stats() FilterStats {
+	stats := FilterStats{Type: ScalableBloomFilterType, Slices: uint(len(f.slices))}
+	trueNegativeRate := 1.0
+	for _, slice := range f.slices {
+		sliceStats := bloomStats(slice.filter)
+		stats.Capacity += sliceStats.Capacity
+		stats.HashFunctions = sliceStats.HashFunctions
+		stats.BitsSet += sliceStats.BitsSet
+		stats.ApproximateCount += slice.count
+		trueNegativeRate *= 1 - sliceStats.EstimatedFalsePositiveRate
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(stats.BitsSet) / float64(stats.Capacity)
+	}
+	stats.EstimatedFalsePositiveRate = 1 - trueNegativeRate
+	return stats
+}
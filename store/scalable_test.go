@@ -0,0 +1,60 @@
+package store
+
+import (
+	"addressdb/address"
+	"github.com/bits-and-blooms/bloom/v3"
+	"github.com/stretchr/testify/require"
+	"math/bits"
+	"os"
+	"testing"
+)
+
+func TestScalableBloomFilterStore(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	falsePositiveRate := 0.01
+
+	bf, err := NewBloomFilterStore(addressHandler, WithScalableEstimates(100, falsePositiveRate))
+	require.NoError(t, err)
+
+	// Add twenty times the configured capacity.
+	addresses := make([]string, 2000)
+	for i := range addresses {
+		addresses[i] = createAddress()
+	}
+	addAddressesToBloomFilter(t, bf, addresses)
+	checkAddressesInBloomFilter(t, bf, addresses)
+
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, bfReloaded, addresses)
+
+	scalable, ok := bfReloaded.current.Load().filter.(*ScalableBloomFilter)
+	require.True(t, ok, "Expected the header to select the scalable backend")
+	require.Equal(t, 5, scalable.Slices(), "100+200+400+800+1600 slices are needed for 2000 addresses")
+	require.Equal(t, uint(5), scalable.Stats().Slices)
+	// Addresses that were false positives when added are not inserted again.
+	require.InDelta(t, 2000, scalable.Stats().ApproximateCount, 2000*falsePositiveRate)
+	require.Equal(t, uint64(scalable.Stats().ApproximateCount), bfReloaded.Metadata().ElementCount, "Only inserted addresses are counted")
+
+	falsePositives := 0
+	trials := 20000
+	for i := 0; i < trials; i++ {
+		if found, _ := bfReloaded.CheckAddress(createAddress()); found {
+			falsePositives++
+		}
+	}
+	require.LessOrEqual(t, float64(falsePositives)/float64(trials), 2*falsePositiveRate, "False positive rate degraded past capacity")
+}
+
+func TestScalableBloomFilterCapacityOverflow(t *testing.T) {
+	f := &ScalableBloomFilter{
+		capacity:          1 << (bits.UintSize - 1),
+		falsePositiveRate: 0.01,
+		slices:            []scalableSlice{{filter: bloom.New(64, 1), capacity: 1 << (bits.UintSize - 1), count: 1 << (bits.UintSize - 1)}},
+	}
+	require.ErrorIs(t, f.Add([]byte("overflow")), ErrFilterFull)
+	require.Equal(t, 1, f.Slices())
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"addressdb/address"
+	"fmt"
+)
+
+// KeyEncoder converts elements of type T to the bytes a store keys them by. Type names the kind of
+// element and is recorded in file headers, so that a file is only loaded as a set of the same kind.
+type KeyEncoder[T any] interface {
+	Encode(element T) ([]byte, error) // Validate the element and convert it to bytes.
+	Type() string                     // Name of the element type, recorded in filter files.
+}
+
+// Hash32Encoder keys 32-byte hashes of the kind it names by their bytes, like the address handler of
+// the same type, so that sets built from either are the same.
+type Hash32Encoder string
+
+const (
+	TxHashes   Hash32Encoder = "tx-hash"   // Transaction hashes, see address.TxHashHandler.
+	CodeHashes Hash32Encoder = "code-hash" // Contract bytecode hashes, see address.CodeHashHandler.
+)
+
+// Encode returns the bytes of hash.
+func (e Hash32Encoder) Encode(hash [32]byte) ([]byte, error) {
+	return hash[:], nil
+}
+
+// Type returns the name of the kind of hash.
+func (e Hash32Encoder) Type() string {
+	return string(e)
+}
+
+// HandlerEncoder keys strings with an AddressHandler, e.g. addresses or domain names.
+type HandlerEncoder struct {
+	Handler address.AddressHandler
+}
+
+// Domains keys normalized domain names, see address.DomainHandler.
+var Domains = HandlerEncoder{Handler: &address.DomainHandler{}}
+
+// Encode validates element with the handler and converts it to bytes.
+func (e HandlerEncoder) Encode(element string) ([]byte, error) {
+	if err := e.Handler.Validate(element); err != nil {
+		return nil, err
+	}
+	return e.Handler.ToBytes(element)
+}
+
+// Type returns the type of the handler.
+func (e HandlerEncoder) Type() string {
+	return e.Handler.Type()
+}
+
+// Set is a private set of elements of type T, such as transaction hashes or domain names. It is a
+// BloomFilterStore keyed by a KeyEncoder, so it takes the same options and shares its file format,
+// encryption, hashing and commitments; Store returns the store to save, reload or merge the set.
+type Set[T any] struct {
+	store   *BloomFilterStore
+	encoder KeyEncoder[T]
+}
+
+// NewSet creates an empty set of the elements encoded by encoder.
+func NewSet[T any](encoder KeyEncoder[T], opts ...Option) (*Set[T], error) {
+	bf, err := NewBloomFilterStore(encoderHandler[T]{encoder}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Set[T]{store: bf, encoder: encoder}, nil
+}
+
+// NewSetFromFile loads a set of the elements encoded by encoder from a file.
+func NewSetFromFile[T any](filePath string, encoder KeyEncoder[T], opts ...Option) (*Set[T], error) {
+	bf, err := NewBloomFilterStoreFromFile(filePath, encoderHandler[T]{encoder}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Set[T]{store: bf, encoder: encoder}, nil
+}
+
+// Store returns the store holding the set. Its string methods, such as AddAddress, only accept
+// elements if T is string.
+func (s *Set[T]) Store() *BloomFilterStore {
+	return s.store
+}
+
+// Add inserts element into the set.
+func (s *Set[T]) Add(element T) error {
+	data, err := s.encoder.Encode(element)
+	if err != nil {
+		return err
+	}
+	return s.store.addBytes(data)
+}
+
+// Remove deletes element from the set, see BloomFilterStore.RemoveAddress.
+func (s *Set[T]) Remove(element T) error {
+	data, err := s.encoder.Encode(element)
+	if err != nil {
+		return err
+	}
+	found, err := s.store.removeBytes(data)
+	if err == nil && !found {
+		err = fmt.Errorf("%s element not found in set", s.encoder.Type())
+	}
+	return err
+}
+
+// Match checks element against the set, see BloomFilterStore.MatchAddress.
+func (s *Set[T]) Match(element T) (Match, error) {
+	data, err := s.encoder.Encode(element)
+	if err != nil {
+		return NotPresent, err
+	}
+	return s.store.matchBytes(data)
+}
+
+// Contains reports whether element is possibly in the set, or definitely if it has an exact tier.
+func (s *Set[T]) Contains(element T) (bool, error) {
+	match, err := s.Match(element)
+	return match != NotPresent, err
+}
+
+// encoderHandler is the AddressHandler of the store of a Set. Strings are encoded only if T is
+// string; other elements must be added through the Set.
+type encoderHandler[T any] struct {
+	encoder KeyEncoder[T]
+}
+
+func (h encoderHandler[T]) Validate(element string) error {
+	_, err := h.ToBytes(element)
+	return err
+}
+
+func (h encoderHandler[T]) ToBytes(element string) ([]byte, error) {
+	if encoder, ok := any(h.encoder).(KeyEncoder[string]); ok {
+		return encoder.Encode(element)
+	}
+	return nil, fmt.Errorf("%s elements cannot be parsed from strings, use the Set", h.encoder.Type())
+}
+
+func (h encoderHandler[T]) Type() string {
+	return h.encoder.Type()
+}
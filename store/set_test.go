@@ -0,0 +1,62 @@
+package store
+
+import (
+	"addressdb/address"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHashes(t *testing.T) {
+	set, err := NewSet[[32]byte](TxHashes, WithEstimates(1000, 0.0001), WithExactMatch())
+	require.NoError(t, err)
+	listed, other := sha256.Sum256([]byte("listed")), sha256.Sum256([]byte("other"))
+	require.NoError(t, set.Add(listed))
+
+	filePath := t.TempDir() + "/txs.gob"
+	require.NoError(t, set.Store().SaveToFile(filePath))
+	loaded, err := NewSetFromFile[[32]byte](filePath, TxHashes)
+	require.NoError(t, err)
+	match, err := loaded.Match(listed)
+	require.NoError(t, err)
+	require.Equal(t, Present, match)
+	found, err := loaded.Contains(other)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	// The file is the same as one built from hex strings with the address handler.
+	bf, err := NewBloomFilterStoreFromFile(filePath, &address.TxHashHandler{})
+	require.NoError(t, err)
+	found, err = bf.CheckAddress("0x" + hex.EncodeToString(listed[:]))
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// Sets of another kind of element do not load the file.
+	_, err = NewSetFromFile[[32]byte](filePath, CodeHashes)
+	require.Error(t, err)
+
+	// Hashes are not parsed from strings by the store of the set.
+	require.Error(t, set.Store().AddAddress(hex.EncodeToString(other[:])))
+}
+
+func TestSetDomains(t *testing.T) {
+	set, err := NewSet[string](Domains, WithFilter(NewCuckooFilter(100)))
+	require.NoError(t, err)
+	require.NoError(t, set.Add("Example.COM."))
+	require.Error(t, set.Add("not a domain"))
+
+	found, err := set.Contains("example.com")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = set.Store().CheckAddress("EXAMPLE.com")
+	require.NoError(t, err)
+	require.True(t, found, "The store of a string set checks strings")
+
+	require.NoError(t, set.Remove("example.com"))
+	require.Error(t, set.Remove("example.com"))
+	found, err = set.Contains("example.com")
+	require.NoError(t, err)
+	require.False(t, found)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"io"
+	"maps"
+)
+
+// snapshot is the state of a store read by queries. Loads publish new snapshots, which are never
+// modified: readers use them without locking, and a write after a load copies the snapshot first.
+// The snapshot of a store being built is mutable instead, updated in place under the store's write
+// lock and read under its read lock, so that adding addresses does not copy the filter.
+type snapshot struct {
+	filter   Filter
+	exact    *exactSet      // Keys confirming filter matches, nil unless WithExactMatch is set.
+	info     addressInfoSet // Info about the addresses, nil unless WithAddressInfo is set.
+	metadata Metadata       // Written to and read from the file header.
+	mutable  bool           // Modified in place under the store's lock, see above.
+}
+
+// match checks key against the filter and, on a match, against the exact tier if there is one.
+func (s *snapshot) match(key []byte) Match {
+	switch {
+	case !s.filter.Test(key):
+		return NotPresent
+	case s.exact == nil:
+		return PossiblyPresent
+	case s.exact.Contains(key):
+		return Present
+	}
+	return NotPresent
+}
+
+// load returns the current snapshot. If it is mutable, the read lock is taken and locked is true;
+// the caller must release it with bf.mu.RUnlock once done with the snapshot.
+func (bf *BloomFilterStore) load() (s *snapshot, locked bool) {
+	s = bf.current.Load()
+	if !s.mutable {
+		return s, false
+	}
+	bf.mu.RLock()
+	return bf.current.Load(), true
+}
+
+// publish makes s the current snapshot.
+func (bf *BloomFilterStore) publish(s *snapshot) {
+	bf.current.Store(s)
+}
+
+// writable returns a mutable snapshot to modify in place, copying and publishing the current one
+// if it is not. The caller must hold the write lock.
+func (bf *BloomFilterStore) writable() (*snapshot, error) {
+	s := bf.current.Load()
+	if s.mutable {
+		return s, nil
+	}
+	switch s.filter.(type) {
+	case *MappedBloomFilter, *XorFilter:
+		return nil, ErrImmutableFilter
+	}
+
+	copied, err := s.copy()
+	if err != nil {
+		return nil, err
+	}
+	bf.publish(copied)
+	return copied, nil
+}
+
+// frozen returns the current snapshot and a copy of the committed keys, both taken under the read
+// lock. A mutable snapshot is copied, so the result is unaffected by later writes to the store.
+func (bf *BloomFilterStore) frozen() (*snapshot, map[string]struct{}, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	s := bf.current.Load()
+	if s.mutable {
+		var err error
+		if s, err = s.copy(); err != nil {
+			return nil, nil, err
+		}
+	}
+	var leaves map[string]struct{}
+	if bf.leaves != nil {
+		leaves = maps.Clone(bf.leaves)
+	}
+	return s, leaves, nil
+}
+
+// copy returns a mutable deep copy of s. The caller must hold the read lock if s is mutable.
+func (s *snapshot) copy() (*snapshot, error) {
+	filter, err := cloneFilter(s.filter)
+	if err != nil {
+		return nil, err
+	}
+	copied := &snapshot{filter: filter, metadata: s.metadata, mutable: true}
+	if s.exact != nil {
+		copied.exact = newExactSet()
+		for _, key := range s.exact.sorted {
+			copied.exact.Add(key)
+		}
+		for key := range s.exact.pending {
+			copied.exact.Add([]byte(key))
+		}
+	}
+	if s.info != nil {
+		copied.info = make(addressInfoSet, len(s.info))
+		for key, entries := range s.info {
+			copied.info[key] = append([]AddressInfo(nil), entries...)
+		}
+	}
+	return copied, nil
+}
+
+// cloneFilter returns a deep copy of filter.
+func cloneFilter(filter Filter) (Filter, error) {
+	if bloomFilter, ok := filter.(*BloomFilter); ok {
+		return &BloomFilter{filter: bloomFilter.filter.Copy()}, nil
+	}
+
+	clone, err := newFilter(filter.Type())
+	if err != nil {
+		return nil, err
+	}
+	r, w := io.Pipe()
+	go func() {
+		_, err := filter.WriteTo(w)
+		w.CloseWithError(err)
+	}()
+	_, err = clone.ReadFrom(r)
+	r.Close()
+	return clone, err
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"addressdb/address"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotConcurrentReload(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001), WithExactMatch(), WithAddressInfo())
+	require.NoError(t, err)
+	present := createAddress()
+	addAddressesToBloomFilter(t, bf, []string{present})
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	loaded := mustLoad(t, filePath, addressHandler, WithAddressInfo())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if match, err := loaded.MatchAddress(present); err != nil || match != Present {
+					t.Errorf("MatchAddress(%s) = %v, %v during reload", present, match, err)
+				}
+				if _, err := loaded.LookupAddress(present); err != nil {
+					t.Errorf("LookupAddress(%s) failed during reload: %v", present, err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, loaded.LoadFromFile(filePath))
+		require.NoError(t, loaded.AddAddress(createAddress()))
+		require.NoError(t, loaded.AddAddressInfo(present, AddressInfo{Category: "c"}))
+	}
+	wg.Wait()
+}
+
+func TestSnapshotWriteAfterLoad(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	filePath := filepath.Join(t.TempDir(), "bloomfilter.gob")
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	loaded := mustLoad(t, filePath, addressHandler)
+	published := loaded.current.Load()
+	require.False(t, published.mutable)
+
+	address := createAddress()
+	require.NoError(t, loaded.AddAddress(address))
+	checkAddressesInBloomFilter(t, loaded, []string{address})
+	require.True(t, loaded.current.Load().mutable)
+
+	// The published snapshot is left unchanged.
+	key, err := loaded.addressKey(address)
+	require.NoError(t, err)
+	require.Equal(t, NotPresent, published.match(key))
+	require.Equal(t, uint64(0), published.metadata.ElementCount)
+}
@@ -2,28 +2,159 @@ package store
 
 import (
 	"addressdb/address"
+	"addressdb/commitment"
 	"addressdb/securedata"
 	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"github.com/bits-and-blooms/bloom/v3"
+	"io"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type BloomFilterStore struct {
-	filter            *bloom.BloomFilter
 	addressHandler    address.AddressHandler
 	secureDataHandler securedata.SecureDataHandler
-	mu                sync.RWMutex // Mutex to handle concurrent reloads.
+	hasher            AddressHasher            // Keyed hash applied to addresses, nil for unkeyed filters.
+	leaves            map[string]struct{}      // ToBytes outputs of the added addresses, nil unless WithCommitment is set.
+	backup            bool                     // Keep the replaced file when saving, see WithBackup.
+	mmap              bool                     // Map unencrypted Bloom filter files when loading, see WithMmap.
+	current           atomic.Pointer[snapshot] // Filter and metadata read by queries, see snapshot.
+	mu                sync.RWMutex             // Serializes writers, and guards mutable snapshots.
 }
 
 // Option defines a functional option for BloomFilterStore.
 type Option func(*BloomFilterStore)
 
+// building returns the snapshot of a store being constructed, which options modify in place.
+func (bf *BloomFilterStore) building() *snapshot {
+	return bf.current.Load()
+}
+
 // WithCapacity sets the capacity for the Bloom filter.
 func WithEstimates(capacity uint, falsePositiveRate float64) Option {
 	return func(bf *BloomFilterStore) {
-		bf.filter = bloom.NewWithEstimates(capacity, falsePositiveRate)
+		s := bf.building()
+		s.filter = NewBloomFilter(capacity, falsePositiveRate)
+		s.metadata.Capacity = capacity
+		s.metadata.FalsePositiveRate = falsePositiveRate
+	}
+}
+
+// AddressHasher is a keyed hash applied to address bytes before they are inserted in or checked
+// against the filter, so that only parties able to compute it can query the filter.
+type AddressHasher interface {
+	Hash(data []byte) ([]byte, error) // Hash address bytes under the key.
+	KeyID() string                    // Identifier of the key, recorded in the file header.
+}
+
+// BatchHasher is implemented by AddressHashers that hash many inputs at once more cheaply than one
+// at a time, e.g. in a single round trip to a server. AddAddresses and CheckAddresses use it.
+type BatchHasher interface {
+	HashBatch(data [][]byte) ([][]byte, error) // Hash each of data under the key, in order.
+}
+
+// WithAddressHasher makes the store hash addresses with hasher before inserting or checking them.
+// The key id is recorded in the file header and checked when loading.
+func WithAddressHasher(hasher AddressHasher) Option {
+	return func(bf *BloomFilterStore) {
+		bf.hasher = hasher
+		bf.building().metadata.KeyID = hasher.KeyID()
+	}
+}
+
+// WithHashKey makes the store hash addresses with HMAC-SHA256 under key before inserting or
+// checking them, so that only holders of the key can query the filter.
+func WithHashKey(key []byte) Option {
+	return WithAddressHasher(hmacHasher(key))
+}
+
+// HashKeyID returns the identifier of a hashing key recorded in file headers. It does not reveal the key.
+func HashKeyID(key []byte) string {
+	id := sha256.Sum256(append([]byte("zkaddrstore-hash-key-id:"), key...))
+	return hex.EncodeToString(id[:8])
+}
+
+// hmacHasher implements AddressHasher with HMAC-SHA256.
+type hmacHasher []byte
+
+func (key hmacHasher) Hash(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (key hmacHasher) KeyID() string {
+	return HashKeyID(key)
+}
+
+// WithCommitment makes the store keep the added addresses, so that SaveToFile can commit to them
+// with a Merkle tree. The root is recorded in the file header and the tree is written next to the
+// file, see CommitmentPath. The tree holds the addresses, so it is encrypted like the filter when a
+// SecureDataHandler is configured.
+func WithCommitment() Option {
+	return func(bf *BloomFilterStore) {
+		bf.leaves = make(map[string]struct{})
+	}
+}
+
+// WithExactMatch adds an exact tier to the store: the keys inserted in the filter are also kept in
+// a sorted set, consulted on filter matches to rule out false positives. The set is saved in the
+// file body, so it is encrypted with the filter when a SecureDataHandler is configured.
+func WithExactMatch() Option {
+	return func(bf *BloomFilterStore) {
+		s := bf.building()
+		s.exact = newExactSet()
+		s.metadata.Exact = true
+	}
+}
+
+// WithSource sets the source label recorded in the file header, e.g. the name of the list.
+func WithSource(source string) Option {
+	return func(bf *BloomFilterStore) {
+		bf.building().metadata.Source = source
+	}
+}
+
+// WithScalableEstimates backs the store with a ScalableBloomFilter whose first slice holds capacity
+// addresses. The filter grows as more addresses are added, keeping the false positive rate below
+// falsePositiveRate.
+func WithScalableEstimates(capacity uint, falsePositiveRate float64) Option {
+	return func(bf *BloomFilterStore) {
+		s := bf.building()
+		s.filter = NewScalableBloomFilter(capacity, falsePositiveRate)
+		s.metadata.Capacity = capacity
+		s.metadata.FalsePositiveRate = falsePositiveRate
+	}
+}
+
+// WithTTL backs the store with a GenerationalBloomFilter matching addresses for ttl after they are
+// added, split into the given number of generations of capacity addresses each. The exact tier
+// entries, commitment leaves and address info of addresses expire with them, when addresses are
+// added or the store is saved.
+func WithTTL(ttl time.Duration, generations uint, capacity uint, falsePositiveRate float64) Option {
+	return func(bf *BloomFilterStore) {
+		s := bf.building()
+		s.filter = NewGenerationalBloomFilter(capacity, falsePositiveRate, ttl, generations)
+		s.metadata.Capacity = capacity
+		s.metadata.FalsePositiveRate = falsePositiveRate
+	}
+}
+
+// WithFilter sets the Filter backend for the store. Legacy files loaded later are decoded into a
+// new filter of the same backend. The targeted capacity and false positive rate recorded in the
+// file header are cleared, as they are not known for an arbitrary filter.
+func WithFilter(filter Filter) Option {
+	return func(bf *BloomFilterStore) {
+		s := bf.building()
+		s.filter = filter
+		s.metadata.Capacity = 0
+		s.metadata.FalsePositiveRate = 0
 	}
 }
 
@@ -36,10 +167,12 @@ func WithSecureDataHandler(handler securedata.SecureDataHandler) Option {
 
 // NewBloomFilterStore creates a new Bloom filter with optional file monitoring capabilities.
 func NewBloomFilterStore(addressHandler address.AddressHandler, opts ...Option) (*BloomFilterStore, error) {
-	bf := &BloomFilterStore{
-		addressHandler: addressHandler,
-		filter:         bloom.NewWithEstimates(10000, 0.0000001), // Default values
-	}
+	bf := &BloomFilterStore{addressHandler: addressHandler}
+	bf.publish(&snapshot{
+		filter:   NewBloomFilter(10000, 0.0000001), // Default values
+		metadata: Metadata{Capacity: 10000, FalsePositiveRate: 0.0000001},
+		mutable:  true,
+	})
 
 	for _, opt := range opts {
 		opt(bf)
@@ -50,10 +183,10 @@ func NewBloomFilterStore(addressHandler address.AddressHandler, opts ...Option)
 
 // NewBloomFilterStoreFromFile creates a new Bloom filter from a file.
 func NewBloomFilterStoreFromFile(filePath string, addressHandler address.AddressHandler, opts ...Option) (*BloomFilterStore, error) {
-	bf := &BloomFilterStore{
-		addressHandler: addressHandler,
-		filter:         bloom.NewWithEstimates(0, 0.1), // Default values
-	}
+	bf := &BloomFilterStore{addressHandler: addressHandler}
+	bf.publish(&snapshot{
+		filter: NewBloomFilter(0, 0.1), // Default values
+	})
 
 	for _, opt := range opts {
 		opt(bf)
@@ -66,110 +199,728 @@ func NewBloomFilterStoreFromFile(filePath string, addressHandler address.Address
 	return bf, nil
 }
 
+// NewXorFilterStore creates an immutable store holding addresses, backed by a XorFilter.
+// AddAddress on the returned store fails with ErrImmutableFilter.
+func NewXorFilterStore(addresses []string, addressHandler address.AddressHandler, opts ...Option) (*BloomFilterStore, error) {
+	bf, err := NewBloomFilterStore(addressHandler, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([][]byte, 0, len(addresses))
+	for _, address := range addresses {
+		addressBytes, err := bf.addressBytes(address)
+		if err != nil {
+			return nil, err
+		}
+		if bf.leaves != nil {
+			bf.leaves[string(addressBytes)] = struct{}{}
+		}
+		key, err := bf.hashAddress(addressBytes)
+		if err != nil {
+			return nil, err
+		}
+		if s := bf.building(); s.exact != nil {
+			s.exact.Add(key)
+		}
+		keys = append(keys, key)
+	}
+
+	filter, err := NewXorFilter(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	s := bf.building()
+	s.filter = filter
+	s.metadata.Capacity = filter.count
+	s.metadata.FalsePositiveRate = xorFalsePositiveRate
+	s.metadata.ElementCount = uint64(filter.count)
+	return bf, nil
+}
+
+// addressKey validates an address and converts it to the bytes inserted in the filter, hashing
+// them with the store's AddressHasher if one is set.
+func (bf *BloomFilterStore) addressKey(address string) ([]byte, error) {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
+		return nil, err
+	}
+	return bf.hashAddress(addressBytes)
+}
+
+// addressBytes validates an address and converts it to bytes.
+func (bf *BloomFilterStore) addressBytes(address string) ([]byte, error) {
+	if err := bf.addressHandler.Validate(address); err != nil {
+		return nil, err
+	}
+	return bf.addressHandler.ToBytes(address)
+}
+
+// hashAddress hashes address bytes with the store's AddressHasher, if one is set.
+func (bf *BloomFilterStore) hashAddress(addressBytes []byte) ([]byte, error) {
+	if bf.hasher != nil {
+		return bf.hasher.Hash(addressBytes)
+	}
+	return addressBytes, nil
+}
+
 // AddAddress inserts an address into the Bloom filter and encrypts the filter.
 func (bf *BloomFilterStore) AddAddress(address string) error {
-	// Validate and convert address
-	if err := bf.addressHandler.Validate(address); err != nil {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
 		return err
 	}
+	return bf.addBytes(addressBytes)
+}
 
-	addressBytes, err := bf.addressHandler.ToBytes(address)
+// addBytes inserts an element given by its validated bytes.
+func (bf *BloomFilterStore) addBytes(addressBytes []byte) error {
+	key, err := bf.hashAddress(addressBytes)
 	if err != nil {
 		return err
 	}
 
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
+	if err := bf.expire(); err != nil {
+		return err
+	}
+	s, err := bf.writable()
+	if err != nil {
+		return err
+	}
+	return bf.add(s, addressBytes, key)
+}
 
-	// Add to the Bloom filter
-	bf.filter.Add(addressBytes)
+// add inserts a validated and hashed address into the mutable snapshot s, under the write lock.
+func (bf *BloomFilterStore) add(s *snapshot, addressBytes, key []byte) error {
+	inserted := true
+	if inserter, ok := s.filter.(Inserter); ok {
+		var err error
+		if inserted, err = inserter.Insert(key); err != nil {
+			return err
+		}
+	} else if err := s.filter.Add(key); err != nil {
+		return err
+	}
+	if inserted {
+		s.metadata.ElementCount++
+	}
+	if bf.leaves != nil {
+		bf.leaves[string(addressBytes)] = struct{}{}
+	}
+	if s.exact != nil {
+		s.exact.Add(key)
+	}
+	return nil
+}
 
+// expire drops the expired elements of a filter whose elements expire, see Expirer, along with their
+// exact tier entries, commitment leaves and address info, and sets the element count to the number of
+// live elements. The caller must hold the write lock.
+func (bf *BloomFilterStore) expire() error {
+	if expirer, ok := bf.current.Load().filter.(Expirer); !ok || !expirer.Expired() {
+		return nil
+	}
+	s, err := bf.writable()
+	if err != nil {
+		return err
+	}
+	s.filter.(Expirer).Expire()
+	if s.exact != nil {
+		s.exact.retain(s.filter.Test)
+	}
+
+	// Leaves and info are kept by address, and hashed to test them against the filter.
+	addresses := make([][]byte, 0, len(bf.leaves)+len(s.info))
+	for address := range bf.leaves {
+		addresses = append(addresses, []byte(address))
+	}
+	for address := range s.info {
+		if _, ok := bf.leaves[address]; !ok {
+			addresses = append(addresses, []byte(address))
+		}
+	}
+	if len(addresses) > 0 {
+		keys, err := bf.hashAll(addresses)
+		if err != nil {
+			return err
+		}
+		for i, address := range addresses {
+			if !s.filter.Test(keys[i]) {
+				delete(bf.leaves, string(address))
+				delete(s.info, string(address))
+			}
+		}
+	}
+	s.metadata.ElementCount = uint64(s.filter.Stats().ApproximateCount)
 	return nil
 }
 
-// CheckAddress decrypts the Bloom filter and checks if an address is in the filter.
-func (bf *BloomFilterStore) CheckAddress(address string) (bool, error) {
-	// Validate and convert address
-	if err := bf.addressHandler.Validate(address); err != nil {
+// RemoveAddress deletes an address from the filter. It fails if the Filter backend does not
+// implement Remover, or if the address is not in the filter.
+func (bf *BloomFilterStore) RemoveAddress(address string) error {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
+		return err
+	}
+	found, err := bf.removeBytes(addressBytes)
+	if err == nil && !found {
+		err = fmt.Errorf("address %s not found in filter", address)
+	}
+	return err
+}
+
+// removeBytes deletes an element given by its validated bytes, reporting whether it was found.
+func (bf *BloomFilterStore) removeBytes(addressBytes []byte) (bool, error) {
+	key, err := bf.hashAddress(addressBytes)
+	if err != nil {
 		return false, err
 	}
 
-	addressBytes, err := bf.addressHandler.ToBytes(address)
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	if _, ok := bf.current.Load().filter.(Remover); !ok {
+		return false, fmt.Errorf("filter type %q does not support removal", bf.current.Load().filter.Type())
+	}
+	s, err := bf.writable()
 	if err != nil {
 		return false, err
 	}
+	// With an exact tier, a filter match may be a false positive whose removal would clear the
+	// fingerprint of another address.
+	if s.exact != nil && !s.exact.Contains(key) {
+		return false, nil
+	}
+	if !s.filter.(Remover).Remove(key) {
+		return false, nil
+	}
+	s.metadata.ElementCount--
+	if bf.leaves != nil {
+		delete(bf.leaves, string(addressBytes))
+	}
+	if s.exact != nil {
+		s.exact.Remove(key)
+	}
+
+	return true, nil
+}
+
+// CheckAddress decrypts the Bloom filter and checks if an address is in the filter. If the store
+// has an exact tier, filter matches are confirmed against it and the result is definite.
+func (bf *BloomFilterStore) CheckAddress(address string) (bool, error) {
+	match, err := bf.MatchAddress(address)
+	return match != NotPresent, err
+}
+
+// MatchAddress checks an address against the filter and, on a match, against the exact tier if
+// the store has one.
+func (bf *BloomFilterStore) MatchAddress(address string) (Match, error) {
+	addressBytes, err := bf.addressBytes(address)
+	if err != nil {
+		return NotPresent, err
+	}
+	return bf.matchBytes(addressBytes)
+}
+
+// matchBytes checks an element given by its validated bytes, see MatchAddress.
+func (bf *BloomFilterStore) matchBytes(addressBytes []byte) (Match, error) {
+	key, err := bf.hashAddress(addressBytes)
+	if err != nil {
+		return NotPresent, err
+	}
+
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+	return s.match(key), nil
+}
+
+// Exact reports whether the store has an exact tier, making its results definite.
+func (bf *BloomFilterStore) Exact() bool {
+	return bf.current.Load().exact != nil
+}
 
+// Stats returns the parameters and current usage of the filter.
+func (bf *BloomFilterStore) Stats() FilterStats {
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+	return s.filter.Stats()
+}
+
+// Close releases the filter if it is mapped from a file, see WithMmap. The store must not be used
+// afterwards.
+func (bf *BloomFilterStore) Close() error {
+	if closer, ok := bf.current.Load().filter.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Metadata returns the metadata of the filter, as read by the last load or written by the last save.
+func (bf *BloomFilterStore) Metadata() Metadata {
+	s, locked := bf.load()
+	if locked {
+		defer bf.mu.RUnlock()
+	}
+	return s.metadata
+}
+
+// Commitment returns the Merkle tree over the addresses added to the store. It returns nil unless
+// the store was created with WithCommitment.
+func (bf *BloomFilterStore) Commitment() *commitment.Tree {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
+	return bf.commitment()
+}
 
-	// Check if the address is in the filter
-	return bf.filter.Test(addressBytes), nil
+func (bf *BloomFilterStore) commitment() *commitment.Tree {
+	if bf.leaves == nil {
+		return nil
+	}
+	leaves := make([][]byte, 0, len(bf.leaves))
+	for leaf := range bf.leaves {
+		leaves = append(leaves, []byte(leaf))
+	}
+	return commitment.New(leaves)
 }
 
+// CommitmentPath returns the path of the Merkle tree written next to the filter file filePath.
+func CommitmentPath(filePath string) string {
+	return filePath + ".merkle"
+}
+
+// LoadCommitment reads the Merkle tree written next to filePath, decrypting it if a SecureDataHandler
+// is configured, and checks that its root matches the one in the header of the loaded filter.
+func (bf *BloomFilterStore) LoadCommitment(filePath string) (*commitment.Tree, error) {
+	root := bf.Metadata().MerkleRoot
+	if root == "" {
+		return nil, fmt.Errorf("filter has no commitment")
+	}
+
+	f, err := os.Open(CommitmentPath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open commitment: %w", err)
+	}
+	defer f.Close()
+
+	var body io.Reader = bufio.NewReader(f)
+	var verifier securedata.VerifyDataReader
+	if bf.secureDataHandler != nil {
+		if verifier, err = bf.secureDataHandler.Reader(body); err != nil {
+			return nil, fmt.Errorf("failed to decrypt commitment: %w", err)
+		}
+		body = verifier
+	}
+	tree, err := commitment.ReadTree(body)
+	if err != nil {
+		return nil, err
+	}
+	if verifier != nil {
+		if err := verifier.VerifySignature(); err != nil {
+			return nil, fmt.Errorf("failed to verify commitment signature: %w", err)
+		}
+	}
+	if hex.EncodeToString(tree.Root()) != root {
+		return nil, fmt.Errorf("commitment root does not match the filter header")
+	}
+	return tree, nil
+}
+
+// LoadFromFile replaces the filter with the one stored in filePath. Files in the versioned format
+// are decoded according to their header, legacy files are decoded with the current filter backend.
+// The address info written next to the file is loaded if the store was created WithAddressInfo.
 func (bf *BloomFilterStore) LoadFromFile(filePath string) error {
 	if filePath == "" {
 		return fmt.Errorf("no file path specified for loading")
 	}
 
-	f, err := os.Open(filePath)
+	var filter Filter
+	var exact *exactSet
+	var metadata *Metadata
+	if bf.mmap {
+		mapped, mappedMetadata, err := bf.mapFilterFile(filePath)
+		if err != nil {
+			return err
+		}
+		if mapped != nil {
+			filter, metadata = mapped, mappedMetadata
+		}
+	}
+	if filter == nil {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to open file: %w", err)
+		}
+		defer f.Close()
+
+		if filter, exact, metadata, err = bf.read(f); err != nil {
+			return err
+		}
+	}
+
+	var info addressInfoSet
+	if bf.wantsAddressInfo() {
+		info = make(addressInfoSet)
+		if metadata.AddressInfo {
+			var err error
+			if info, err = bf.readAddressInfo(AddressInfoPath(filePath), metadata.Checksum); err != nil {
+				closeFilter(filter) // Never published, so not in use.
+				return err
+			}
+		}
+	}
+
+	bf.replace(filter, exact, info, metadata)
+	return nil
+}
+
+// LoadFrom replaces the filter with the one read from r, decrypting and verifying it like
+// LoadFromFile. Reads are buffered, so r may be read past the end of the filter. Address info is
+// not read, as it is stored in another file; a store created WithAddressInfo gets an empty set.
+func (bf *BloomFilterStore) LoadFrom(r io.Reader) error {
+	filter, exact, metadata, err := bf.read(r)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
+	}
+
+	var info addressInfoSet
+	if bf.wantsAddressInfo() {
+		info = make(addressInfoSet)
+	}
+	bf.replace(filter, exact, info, metadata)
+	return nil
+}
+
+// read decodes a filter in the versioned or legacy format from r.
+func (bf *BloomFilterStore) read(r io.Reader) (Filter, *exactSet, *Metadata, error) {
+	br := bufio.NewReader(r)
+	if prefix, _ := br.Peek(len(formatMagic)); isVersioned(prefix) {
+		return bf.readVersioned(br)
+	}
+	filter, metadata, err := bf.readLegacy(br)
+	return filter, nil, metadata, err
+}
+
+// replace publishes a loaded filter. A mapped filter it replaces is released once no query uses it.
+func (bf *BloomFilterStore) replace(filter Filter, exact *exactSet, info addressInfoSet, metadata *Metadata) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.publish(&snapshot{filter: filter, exact: exact, info: info, metadata: *metadata})
+}
+
+// closeFilter releases the resources held by filter, such as the mapping of a MappedBloomFilter.
+func closeFilter(filter Filter) {
+	if closer, ok := filter.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// readVersioned decodes a file in the versioned format, checking its checksum and signature. The
+// exact tier is nil if the file has none.
+func (bf *BloomFilterStore) readVersioned(r io.Reader) (Filter, *exactSet, *Metadata, error) {
+	metadata, header, err := readHeader(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := bf.checkMetadata(metadata); err != nil {
+		return nil, nil, nil, err
+	}
+
+	filter, err := newFilter(metadata.FilterType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var verifier securedata.VerifyDataReader
+	body := r
+	switch {
+	case metadata.Encrypted && bf.secureDataHandler == nil:
+		return nil, nil, nil, fmt.Errorf("file is encrypted but no secure data handler is configured")
+	case !metadata.Encrypted && bf.secureDataHandler != nil:
+		return nil, nil, nil, fmt.Errorf("file is not encrypted but a secure data handler is configured")
+	case metadata.Encrypted:
+		verifier, err = bf.secureDataHandler.Reader(r)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to decrypt file: %w", err)
+		}
+		body = verifier
+	}
+
+	hash := sha256.New()
+	hash.Write(header)
+	if _, err := filter.ReadFrom(io.TeeReader(body, hash)); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read filter: %w", err)
+	}
+	var exact *exactSet
+	if metadata.Exact {
+		exact = newExactSet()
+		if _, err := exact.ReadFrom(io.TeeReader(body, hash)); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read exact tier: %w", err)
+		}
+	}
+	checksum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(body, checksum); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read checksum: %w", err)
+	}
+	if !bytes.Equal(checksum, hash.Sum(nil)) {
+		return nil, nil, nil, fmt.Errorf("checksum mismatch, file is corrupted")
+	}
+	if verifier != nil {
+		if err := verifier.VerifySignature(); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to verify signature: %w", err)
+		}
+	}
+
+	metadata.Checksum = hex.EncodeToString(checksum)
+	return filter, exact, metadata, nil
+}
+
+// checkMetadata checks that a file holds addresses of the configured type, keyed with the
+// configured hash key.
+func (bf *BloomFilterStore) checkMetadata(metadata *Metadata) error {
+	if metadata.AddressType != bf.addressHandler.Type() {
+		return fmt.Errorf("file holds %q addresses, expected %q", metadata.AddressType, bf.addressHandler.Type())
+	}
+	switch keyID := bf.hashKeyID(); {
+	case metadata.KeyID == "" && keyID != "":
+		return fmt.Errorf("file is not keyed but a hash key is configured")
+	case metadata.KeyID != "" && keyID == "":
+		return fmt.Errorf("file is keyed with key %s but no hash key is configured", metadata.KeyID)
+	case metadata.KeyID != keyID:
+		return fmt.Errorf("file is keyed with key %s, configured hash key is %s", metadata.KeyID, keyID)
+	}
+	return nil
+}
+
+// wantsAddressInfo reports whether the store was configured WithAddressInfo.
+func (bf *BloomFilterStore) wantsAddressInfo() bool {
+	return bf.current.Load().info != nil
+}
+
+// hashKeyID returns the id of the configured hash key, or "" if the store is not keyed.
+func (bf *BloomFilterStore) hashKeyID() string {
+	if bf.hasher == nil {
+		return ""
+	}
+	return bf.hasher.KeyID()
+}
+
+// readLegacy decodes a file holding only a serialized filter of the current backend.
+func (bf *BloomFilterStore) readLegacy(r io.Reader) (Filter, *Metadata, error) {
+	if bf.hasher != nil {
+		return nil, nil, fmt.Errorf("legacy files cannot be keyed but a hash key is configured")
+	}
+	filter, err := newFilter(bf.current.Load().filter.Type())
+	if err != nil {
+		return nil, nil, err
 	}
-	defer f.Close()
 
-	var filter bloom.BloomFilter
 	if bf.secureDataHandler != nil {
-		r, err := bf.secureDataHandler.Reader(f)
+		r, err := bf.secureDataHandler.Reader(r)
 		if err != nil {
-			return fmt.Errorf("failed to decrypt file: %w", err)
+			return nil, nil, fmt.Errorf("failed to decrypt file: %w", err)
 		}
 		if _, err := filter.ReadFrom(r); err != nil {
-			return fmt.Errorf("failed to read Bloom filter: %w", err)
+			return nil, nil, fmt.Errorf("failed to read Bloom filter: %w", err)
 		}
 		if err := r.VerifySignature(); err != nil {
-			return fmt.Errorf("failed to verify signature: %w", err)
+			return nil, nil, fmt.Errorf("failed to verify signature: %w", err)
 		}
 	} else {
-		r := bufio.NewReader(f)
 		if _, err := filter.ReadFrom(r); err != nil {
-			return fmt.Errorf("failed to read Bloom filter: %w", err)
+			return nil, nil, fmt.Errorf("failed to read Bloom filter: %w", err)
 		}
 	}
 
-	bf.mu.Lock()
-	defer bf.mu.Unlock()
-	bf.filter = &filter
-
-	return nil
+	return filter, &Metadata{
+		FilterType:   filter.Type(),
+		AddressType:  bf.addressHandler.Type(),
+		ElementCount: uint64(filter.Stats().ApproximateCount),
+		Encrypted:    bf.secureDataHandler != nil,
+	}, nil
 }
 
-// SaveToFile saves the encrypted Bloom filter to the specified file.
+// SaveToFile saves the filter to the specified file in the versioned format, encrypting it if a
+// SecureDataHandler is configured. The file is replaced atomically: it is written to a temporary
+// file in the same directory, synced and renamed over the previous one.
 func (bf *BloomFilterStore) SaveToFile(filePath string) error {
 	if filePath == "" {
 		return fmt.Errorf("no file path specified for saving")
 	}
 
-	f, err := os.Create(filePath)
+	backupPath := ""
+	if bf.backup {
+		backupPath = BackupPath(filePath)
+	}
+	// The file and the files next to it are written to temporary files, and the file is renamed into
+	// place last, so that a reload never sees a partial file or one newer than the files next to it.
+	f, err := createAtomic(filePath, backupPath)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %v", err)
 	}
-	defer f.Close()
+	defer f.Abort()
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if err := bf.expire(); err != nil {
+		return err
+	}
+
+	tree := bf.commitment()
+	if tree != nil {
+		if err := bf.writeCommitment(CommitmentPath(filePath), sidecarBackupPath(backupPath, CommitmentPath), tree); err != nil {
+			return err
+		}
+	}
+	current := bf.current.Load()
+	saved, _, err := bf.writeTo(f, current, tree, current.info != nil, time.Now())
+	if err != nil {
+		return err
+	}
+	if saved.info != nil {
+		if err := bf.writeAddressInfo(AddressInfoPath(filePath), sidecarBackupPath(backupPath, AddressInfoPath), saved); err != nil {
+			return err
+		}
+	}
+	if err := f.Commit(); err != nil {
+		return err
+	}
+	bf.publish(saved)
+	return nil
+}
 
+// WriteTo writes the filter to w in the versioned format, encrypting and signing it like SaveToFile.
+// The commitment tree and address info, which SaveToFile writes next to the file, are not written;
+// the header still holds the Merkle root.
+func (bf *BloomFilterStore) WriteTo(w io.Writer) (int64, error) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if err := bf.expire(); err != nil {
+		return 0, err
+	}
+	saved, n, err := bf.writeTo(w, bf.current.Load(), bf.commitment(), false, time.Now())
+	if err == nil {
+		bf.publish(saved)
+	}
+	return n, err
+}
+
+// writeTo writes the header and body of s to w, committing to tree if it is not nil. addressInfo
+// records in the header whether address info is written next to the file, and buildTime is recorded
+// as the time the filter was built. It returns a copy of s holding the metadata written, to publish
+// once saved. The caller must hold the lock if s is mutable.
+func (bf *BloomFilterStore) writeTo(w io.Writer, s *snapshot, tree *commitment.Tree, addressInfo bool, buildTime time.Time) (*snapshot, int64, error) {
+	saved := *s
+	metadata := &saved.metadata
+	metadata.Version = FormatVersion
+	metadata.FilterType = s.filter.Type()
+	metadata.AddressType = bf.addressHandler.Type()
+	metadata.BuildTime = buildTime.UTC()
+	metadata.Encrypted = bf.secureDataHandler != nil
+	metadata.Exact = s.exact != nil
+	metadata.AddressInfo = addressInfo
+	metadata.Checksum = ""
+	if tree != nil {
+		metadata.MerkleRoot = hex.EncodeToString(tree.Root())
+	}
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	header, err := writeHeader(bw, metadata)
+	if err != nil {
+		return nil, cw.n, err
+	}
+
+	var body io.WriteCloser = nopWriteCloser{bw}
 	if bf.secureDataHandler != nil {
-		w, err := bf.secureDataHandler.Writer(f)
+		body, err = bf.secureDataHandler.Writer(bw)
 		if err != nil {
-			return fmt.Errorf("failed to encrypt file: %v", err)
+			return nil, cw.n, fmt.Errorf("failed to encrypt file: %v", err)
 		}
-		if _, err := bf.filter.WriteTo(w); err != nil {
-			return err
+	}
+
+	hash := sha256.New()
+	hash.Write(header)
+	if _, err := s.filter.WriteTo(io.MultiWriter(body, hash)); err != nil {
+		return nil, cw.n, err
+	}
+	if s.exact != nil {
+		if _, err := s.exact.WriteTo(io.MultiWriter(body, hash)); err != nil {
+			return nil, cw.n, err
 		}
-		return w.Close()
 	}
+	checksum := hash.Sum(nil)
+	if _, err := body.Write(checksum); err != nil {
+		return nil, cw.n, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, cw.n, err
+	}
+	metadata.Checksum = hex.EncodeToString(checksum)
+
+	if err := bw.Flush(); err != nil {
+		return nil, cw.n, err
+	}
+	return &saved, cw.n, nil
+}
+
+// sidecarBackupPath returns the path a file written next to a filter file is backed up at, given
+// the backup path of the filter file, so that the backup can be loaded like the original.
+func sidecarBackupPath(backupPath string, path func(string) string) string {
+	if backupPath == "" {
+		return ""
+	}
+	return path(backupPath)
+}
+
+// writeCommitment writes the leaves of tree to filePath, encrypted if a SecureDataHandler is
+// configured, keeping the replaced file at backupPath unless it is empty.
+func (bf *BloomFilterStore) writeCommitment(filePath, backupPath string, tree *commitment.Tree) error {
+	f, err := createAtomic(filePath, backupPath)
+	if err != nil {
+		return fmt.Errorf("failed to create commitment file: %w", err)
+	}
+	defer f.Abort()
 
 	w := bufio.NewWriter(f)
-	if _, err := bf.filter.WriteTo(w); err != nil {
-		return err
+	var body io.WriteCloser = nopWriteCloser{w}
+	if bf.secureDataHandler != nil {
+		if body, err = bf.secureDataHandler.Writer(w); err != nil {
+			return fmt.Errorf("failed to encrypt commitment: %w", err)
+		}
 	}
+	if _, err := tree.WriteTo(body); err != nil {
+		return fmt.Errorf("failed to write commitment: %w", err)
+	}
+	if err := body.Close(); err != nil {
+		return fmt.Errorf("failed to write commitment: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write commitment: %w", err)
+	}
+	return f.Commit()
+}
 
-	return w.Flush()
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -2,10 +2,14 @@ package store
 
 import (
 	"addressdb/address"
+	"addressdb/commitment"
 	"addressdb/securedata"
+	"bytes"
+	"encoding/hex"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/stretchr/testify/require"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +41,7 @@ func TestBloomFilterStoreFunctional(t *testing.T) {
 	}{
 		{name: "default"},
 		{name: "WithEstimates", writer_opts: []Option{WithEstimates(100, 0.0000001)}},
+		{name: "WithFilter", writer_opts: []Option{WithFilter(NewBloomFilter(100, 0.0000001))}, reader_opts: []Option{WithFilter(NewBloomFilter(0, 0.1))}},
 		{name: "WithEncryption", writer_opts: []Option{WithSecureDataHandler(aliceWriter)}, reader_opts: []Option{WithSecureDataHandler(bobReader)}},
 		{name: "chad unauthorized access", writer_opts: []Option{WithSecureDataHandler(aliceWriter)}, reader_opts: []Option{WithSecureDataHandler(chadReader)}, wantReadErr: true},
 		{name: "chad impersonate alice", writer_opts: []Option{WithSecureDataHandler(chadWriter)}, reader_opts: []Option{WithSecureDataHandler(bobReader)}, wantReadErr: true},
@@ -96,3 +101,236 @@ func createAddress() string {
 	key, _ := crypto.GenerateKey()
 	return crypto.PubkeyToAddress(key.PublicKey).Hex()
 }
+
+func TestBloomFilterStoreStats(t *testing.T) {
+	bf, err := NewBloomFilterStore(&address.EVMAddressHandler{}, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+
+	empty := bf.Stats()
+	require.Equal(t, BloomFilterType, empty.Type)
+	require.Zero(t, empty.BitsSet)
+	require.Zero(t, empty.EstimatedFalsePositiveRate)
+
+	addresses := make([]string, 1000)
+	for i := range addresses {
+		addresses[i] = createAddress()
+	}
+	addAddressesToBloomFilter(t, bf, addresses)
+
+	stats := bf.Stats()
+	require.NotZero(t, stats.Capacity)
+	require.NotZero(t, stats.HashFunctions)
+	require.Equal(t, float64(stats.BitsSet)/float64(stats.Capacity), stats.FillRatio)
+	require.InDelta(t, 1000, stats.ApproximateCount, 50)
+	// At the configured capacity the estimated rate should be close to the target.
+	require.InDelta(t, 0.001, stats.EstimatedFalsePositiveRate, 0.0005)
+}
+
+func TestBloomFilterStoreHashKey(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	key := []byte("0123456789abcdef0123456789abcdef")
+	otherKey := []byte("fedcba9876543210fedcba9876543210")
+
+	bf, err := NewBloomFilterStore(addressHandler, WithHashKey(key))
+	require.NoError(t, err)
+	addresses := []string{createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler, WithHashKey(key))
+	require.NoError(t, err)
+	checkAddressesInBloomFilter(t, bfReloaded, addresses)
+	require.Equal(t, HashKeyID(key), bfReloaded.Metadata().KeyID)
+
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.Error(t, err, "Expected error when loading a keyed file without the key")
+
+	_, err = NewBloomFilterStoreFromFile(filePath, addressHandler, WithHashKey(otherKey))
+	require.Error(t, err, "Expected error when loading a keyed file with another key")
+
+	// Without the key the filter bits do not match the plain address bytes.
+	unkeyed, err := NewBloomFilterStore(addressHandler)
+	require.NoError(t, err)
+	unkeyed.building().filter = bfReloaded.current.Load().filter
+	found, err := unkeyed.CheckAddress(addresses[0])
+	require.NoError(t, err)
+	require.False(t, found)
+
+	plainPath := os.TempDir() + "/bloomfilter-unkeyed.gob"
+	require.NoError(t, unkeyed.SaveToFile(plainPath))
+	defer os.Remove(plainPath)
+	_, err = NewBloomFilterStoreFromFile(plainPath, addressHandler, WithHashKey(key))
+	require.Error(t, err, "Expected error when loading an unkeyed file with a key")
+}
+
+func TestBloomFilterStoreCommitment(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+	bf, err := NewBloomFilterStore(addressHandler, WithCommitment())
+	require.NoError(t, err)
+	addresses := []string{createAddress(), createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+	defer os.Remove(CommitmentPath(filePath))
+
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler)
+	require.NoError(t, err)
+	root := bfReloaded.Metadata().MerkleRoot
+	require.Equal(t, hex.EncodeToString(bf.Commitment().Root()), root)
+
+	tree, err := bfReloaded.LoadCommitment(filePath)
+	require.NoError(t, err)
+	require.Equal(t, len(addresses), tree.Len())
+	for _, addr := range addresses {
+		leaf, err := addressHandler.ToBytes(addr)
+		require.NoError(t, err)
+		proof, err := tree.Prove(leaf)
+		require.NoError(t, err)
+		require.NoError(t, commitment.VerifyInclusion(tree.Root(), leaf, proof))
+	}
+
+	// A tree that does not match the header is rejected.
+	other, err := NewBloomFilterStore(addressHandler, WithCommitment())
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, other, []string{createAddress()})
+	otherPath := os.TempDir() + "/bloomfilter-other.gob"
+	require.NoError(t, other.SaveToFile(otherPath))
+	defer os.Remove(otherPath)
+	require.NoError(t, os.Rename(CommitmentPath(otherPath), CommitmentPath(filePath)))
+	_, err = bfReloaded.LoadCommitment(filePath)
+	require.Error(t, err, "Expected error when the tree does not match the header")
+}
+
+func TestBloomFilterStoreEncryptedCommitment(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	bf, err := NewBloomFilterStore(addressHandler, WithCommitment(), WithSecureDataHandler(aliceWriter))
+	require.NoError(t, err)
+	addresses := []string{createAddress(), createAddress(), createAddress()}
+	addAddressesToBloomFilter(t, bf, addresses)
+	filePath := t.TempDir() + "/bloomfilter.gob"
+	require.NoError(t, bf.SaveToFile(filePath))
+
+	// The tree written next to the filter does not reveal the addresses.
+	data, err := os.ReadFile(CommitmentPath(filePath))
+	require.NoError(t, err)
+	for _, addr := range addresses {
+		leaf, err := addressHandler.ToBytes(addr)
+		require.NoError(t, err)
+		require.False(t, bytes.Contains(data, leaf), "Commitment must be encrypted")
+	}
+
+	loaded := mustLoad(t, filePath, addressHandler, WithSecureDataHandler(bobReader))
+	tree, err := loaded.LoadCommitment(filePath)
+	require.NoError(t, err)
+	require.Equal(t, bf.Commitment().Root(), tree.Root())
+
+	// A tampered tree is rejected.
+	data[len(data)/2] ^= 1
+	require.NoError(t, os.WriteFile(CommitmentPath(filePath), data, 0o644))
+	_, err = loaded.LoadCommitment(filePath)
+	require.Error(t, err)
+}
+
+func TestBloomFilterStoreLoadFromWriteTo(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	aliceWriter, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	bobReader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+	addressHandler := &address.EVMAddressHandler{}
+
+	tests := []struct {
+		name   string
+		writer []Option
+		reader []Option
+	}{
+		{"plain", nil, nil},
+		{"encrypted", []Option{WithSecureDataHandler(aliceWriter)}, []Option{WithSecureDataHandler(bobReader)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bf, err := NewBloomFilterStore(addressHandler, append(tt.writer, WithEstimates(1000, 0.001), WithExactMatch())...)
+			require.NoError(t, err)
+			addresses := []string{createAddress(), createAddress()}
+			addAddressesToBloomFilter(t, bf, addresses)
+
+			var buf bytes.Buffer
+			n, err := bf.WriteTo(&buf)
+			require.NoError(t, err)
+			require.Equal(t, int64(buf.Len()), n)
+
+			loaded, err := NewBloomFilterStore(addressHandler, tt.reader...)
+			require.NoError(t, err)
+			require.NoError(t, loaded.LoadFrom(&buf))
+			checkAddressesInBloomFilter(t, loaded, addresses)
+			require.True(t, loaded.Exact())
+			require.Equal(t, bf.Metadata(), loaded.Metadata())
+		})
+	}
+
+	// Corrupted streams are rejected and leave the store unchanged.
+	bf, err := NewBloomFilterStore(addressHandler, WithEstimates(1000, 0.001))
+	require.NoError(t, err)
+	addAddressesToBloomFilter(t, bf, []string{createAddress()})
+	var buf bytes.Buffer
+	_, err = bf.WriteTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+	data[len(data)-1] ^= 1
+	loaded, err := NewBloomFilterStore(addressHandler)
+	require.NoError(t, err)
+	require.Error(t, loaded.LoadFrom(bytes.NewReader(data)))
+	require.Equal(t, "", loaded.Metadata().Checksum)
+}
+
+func TestBloomFilterStoreElementTypes(t *testing.T) {
+	keys := securedata.GenerateTestKeys(t)
+	writer, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[0]), securedata.WithPublicKey(keys[3]))
+	require.NoError(t, err)
+	reader, err := securedata.NewPGPSecureHandler(securedata.WithPrivateKey(keys[2]), securedata.WithPublicKey(keys[1]))
+	require.NoError(t, err)
+
+	tests := []struct {
+		handler address.AddressHandler
+		added   string
+		lookup  string // Same element as added, as normalized by the handler.
+		other   string
+	}{
+		{&address.TxHashHandler{}, "0x" + strings.Repeat("1f", 32), strings.Repeat("1F", 32), "0x" + strings.Repeat("2f", 32)},
+		{&address.CodeHashHandler{}, "0x" + strings.Repeat("c0", 32), "0x" + strings.Repeat("c0", 32), "0x" + strings.Repeat("c1", 32)},
+		{&address.DomainHandler{}, "Drainer.example.", "drainer.example", "example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.handler.Type(), func(t *testing.T) {
+			bf, err := NewBloomFilterStore(tt.handler, WithEstimates(1000, 0.0001), WithExactMatch(), WithSecureDataHandler(writer))
+			require.NoError(t, err)
+			require.NoError(t, bf.AddAddress(tt.added))
+			require.Error(t, bf.AddAddress("not an element!"), "Expected invalid elements to be rejected")
+
+			filePath := t.TempDir() + "/set.gob"
+			require.NoError(t, bf.SaveToFile(filePath))
+			handler, err := ReadAddressHandler(filePath)
+			require.NoError(t, err)
+			require.Equal(t, tt.handler.Type(), handler.Type())
+
+			loaded, err := NewBloomFilterStoreFromFile(filePath, handler, WithSecureDataHandler(reader))
+			require.NoError(t, err)
+			match, err := loaded.MatchAddress(tt.lookup)
+			require.NoError(t, err)
+			require.Equal(t, Present, match)
+			match, err = loaded.MatchAddress(tt.other)
+			require.NoError(t, err)
+			require.Equal(t, NotPresent, match)
+
+			_, err = NewBloomFilterStoreFromFile(filePath, &address.EVMAddressHandler{}, WithSecureDataHandler(reader))
+			require.Error(t, err, "Expected the element type in the header to be checked")
+		})
+	}
+}
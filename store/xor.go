@@ -0,0 +1,248 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"math/rand"
+)
+
+// XorFilterType is the name of the xor filter backend.
+const XorFilterType = "xor"
+
+const (
+	xorMaxAttempts  = 100  // Seeds tried before giving up on building a filter.
+	xorChunkEntries = 8192 // Fingerprints encoded per write when serializing.
+
+	xorFalsePositiveRate = 1.0 / (1 << 16) // Chance that a random key matches a 16-bit fingerprint.
+)
+
+// ErrImmutableFilter is returned when adding to a filter that cannot change after construction.
+var ErrImmutableFilter = errors.New("filter is immutable")
+
+func init() {
+	RegisterFilter(XorFilterType, func() Filter { return &XorFilter{} })
+}
+
+// XorFilter implements Filter with an immutable xor filter using 16-bit fingerprints. It takes
+// about 19.7 bits per element for a false positive rate of roughly 1.5e-5, compared to about
+// 24 bits per element for a Bloom filter at the same rate. All elements must be known up front
+// when calling NewXorFilter; Add always fails with ErrImmutableFilter.
+type XorFilter struct {
+	seed         uint64
+	blockLength  uint32
+	count        uint
+	fingerprints []uint16
+}
+
+// NewXorFilter builds a xor filter holding keys. Duplicate keys are ignored.
+func NewXorFilter(keys [][]byte) (*XorFilter, error) {
+	hashes := make([]uint64, 0, len(keys))
+	seen := make(map[uint64]struct{}, len(keys))
+	for _, key := range keys {
+		h := xorKeyHash(key)
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		hashes = append(hashes, h)
+	}
+
+	capacity := 32 + uint32(1.23*float64(len(hashes)))
+	capacity = capacity / 3 * 3
+	f := &XorFilter{
+		blockLength:  capacity / 3,
+		count:        uint(len(hashes)),
+		fingerprints: make([]uint16, capacity),
+	}
+
+	type keyIndex struct {
+		hash  uint64
+		index uint32
+	}
+	type xorSet struct {
+		mask  uint64
+		count uint32
+	}
+
+	sets := make([]xorSet, capacity)
+	queue := make([]uint32, 0, capacity)
+	stack := make([]keyIndex, 0, len(hashes))
+	for attempt := 0; attempt < xorMaxAttempts; attempt++ {
+		f.seed = rand.Uint64()
+		for i := range sets {
+			sets[i] = xorSet{}
+		}
+		for _, key := range hashes {
+			h := xorMix(key, f.seed)
+			for _, i := range f.locations(h) {
+				sets[i].mask ^= h
+				sets[i].count++
+			}
+		}
+
+		// Peel slots referenced by a single key until every key has a slot of its own.
+		queue, stack = queue[:0], stack[:0]
+		for i := range sets {
+			if sets[i].count == 1 {
+				queue = append(queue, uint32(i))
+			}
+		}
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if sets[i].count != 1 {
+				continue
+			}
+			h := sets[i].mask
+			stack = append(stack, keyIndex{hash: h, index: i})
+			for _, j := range f.locations(h) {
+				sets[j].mask ^= h
+				sets[j].count--
+				if sets[j].count == 1 {
+					queue = append(queue, j)
+				}
+			}
+		}
+
+		if len(stack) == len(hashes) {
+			for n := len(stack) - 1; n >= 0; n-- {
+				ki := stack[n]
+				locs := f.locations(ki.hash)
+				f.fingerprints[ki.index] = xorFingerprint(ki.hash) ^ f.fingerprints[locs[0]] ^ f.fingerprints[locs[1]] ^ f.fingerprints[locs[2]]
+			}
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to build xor filter after %d attempts", xorMaxAttempts)
+}
+
+// xorKeyHash hashes a key to the 64-bit value the filter is built from.
+func xorKeyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// xorMix combines a key hash with the filter seed using the murmur3 finalizer.
+func xorMix(key, seed uint64) uint64 {
+	h := key + seed
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func xorFingerprint(h uint64) uint16 {
+	return uint16(h ^ (h >> 32))
+}
+
+// locations returns the slot of h in each of the three blocks.
+func (f *XorFilter) locations(h uint64) [3]uint32 {
+	reduce := func(x uint32) uint32 {
+		return uint32((uint64(x) * uint64(f.blockLength)) >> 32)
+	}
+	return [3]uint32{
+		reduce(uint32(h)),
+		reduce(uint32(bits.RotateLeft64(h, 21))) + f.blockLength,
+		reduce(uint32(bits.RotateLeft64(h, 42))) + 2*f.blockLength,
+	}
+}
+
+// Add always fails, xor filters cannot be modified once built.
+func (f *XorFilter) Add(_ []byte) error {
+	return fmt.Errorf("%w: xor filters must be built from the complete address set with NewXorFilter", ErrImmutableFilter)
+}
+
+// Test reports whether data is possibly in the filter.
+func (f *XorFilter) Test(data []byte) bool {
+	if len(f.fingerprints) == 0 {
+		return false
+	}
+	h := xorMix(xorKeyHash(data), f.seed)
+	locs := f.locations(h)
+	return xorFingerprint(h) == f.fingerprints[locs[0]]^f.fingerprints[locs[1]]^f.fingerprints[locs[2]]
+}
+
+// WriteTo writes the filter to w.
+func (f *XorFilter) WriteTo(w io.Writer) (int64, error) {
+	header := []uint64{f.seed, uint64(f.blockLength), uint64(f.count)}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	n := int64(len(header) * 8)
+	buf := make([]byte, 2*xorChunkEntries)
+	for start := 0; start < len(f.fingerprints); start += xorChunkEntries {
+		chunk := f.fingerprints[start:min(start+xorChunkEntries, len(f.fingerprints))]
+		for i, fp := range chunk {
+			binary.BigEndian.PutUint16(buf[i*2:], fp)
+		}
+		written, err := w.Write(buf[:len(chunk)*2])
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom reads the filter from r.
+func (f *XorFilter) ReadFrom(r io.Reader) (int64, error) {
+	header := make([]uint64, 3)
+	if err := binary.Read(r, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	if header[1] == 0 || header[1] > 1<<31 {
+		return int64(len(header) * 8), errors.New("invalid xor filter: bad block length")
+	}
+
+	// Fingerprints are allocated as they are read, so a corrupted length fails on the end of the
+	// data rather than allocating memory for fingerprints that are not there.
+	n := int64(len(header) * 8)
+	total := 3 * header[1]
+	fingerprints := make([]uint16, 0, min(total, xorChunkEntries))
+	buf := make([]byte, 2*xorChunkEntries)
+	for uint64(len(fingerprints)) < total {
+		size := int(min(total-uint64(len(fingerprints)), xorChunkEntries))
+		read, err := io.ReadFull(r, buf[:size*2])
+		n += int64(read)
+		if err != nil {
+			return n, err
+		}
+		for i := 0; i < size; i++ {
+			fingerprints = append(fingerprints, binary.BigEndian.Uint16(buf[i*2:]))
+		}
+	}
+
+	f.seed = header[0]
+	f.blockLength = uint32(header[1])
+	f.count = uint(header[2])
+	f.fingerprints = fingerprints
+	return n, nil
+}
+
+// Type returns XorFilterType.
+func (f *XorFilter) Type() string {
+	return XorFilterType
+}
+
+// Stats returns the number of slots and elements of the filter.
+func (f *XorFilter) Stats() FilterStats {
+	stats := FilterStats{
+		Type:                       XorFilterType,
+		Capacity:                   uint(len(f.fingerprints)),
+		HashFunctions:              3,
+		ApproximateCount:           f.count,
+		EstimatedFalsePositiveRate: xorFalsePositiveRate,
+	}
+	if stats.Capacity > 0 {
+		stats.FillRatio = float64(f.count) / float64(stats.Capacity)
+	}
+	return stats
+}
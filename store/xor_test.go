@@ -0,0 +1,58 @@
+package store
+
+import (
+	"addressdb/address"
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestXorFilterStore(t *testing.T) {
+	addressHandler := &address.EVMAddressHandler{}
+
+	addresses := make([]string, 1000)
+	for i := range addresses {
+		addresses[i] = createAddress()
+	}
+	// Duplicates are ignored rather than breaking construction.
+	addresses = append(addresses, addresses[0])
+
+	bf, err := NewXorFilterStore(addresses, addressHandler)
+	require.NoError(t, err, "Failed to build xor filter store")
+	checkAddressesInBloomFilter(t, bf, addresses)
+
+	err = bf.AddAddress(createAddress())
+	require.ErrorIs(t, err, ErrImmutableFilter)
+
+	filePath := saveBloomFilterToFile(t, bf)
+	defer os.Remove(filePath)
+
+	bfReloaded, err := NewBloomFilterStoreFromFile(filePath, addressHandler, WithFilter(&XorFilter{}))
+	require.NoError(t, err, "Failed to load xor filter from file")
+	checkAddressesInBloomFilter(t, bfReloaded, addresses)
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if found, _ := bfReloaded.CheckAddress(createAddress()); found {
+			falsePositives++
+		}
+	}
+	require.LessOrEqual(t, falsePositives, 5, "False positive rate is far above the expected 1.5e-5")
+}
+
+func TestXorFilterStoreInvalidAddress(t *testing.T) {
+	_, err := NewXorFilterStore([]string{"not an address"}, &address.EVMAddressHandler{})
+	require.Error(t, err)
+}
+
+func TestXorFilterReadFromCorrupted(t *testing.T) {
+	// A header claiming more fingerprints than follow must fail without allocating them all.
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.BigEndian, []uint64{0, 1 << 31, 0}))
+	buf.Write(make([]byte, 64))
+	_, err := new(XorFilter).ReadFrom(&buf)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
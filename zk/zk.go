@@ -0,0 +1,831 @@
+// Package zk proves in zero knowledge that a committed address is, or is not, in a committed list,
+// without revealing the address or where it sits in the list.
+//
+// Instead of compiling a circuit for a SNARK, it uses one-out-of-many proofs (Groth and Kohlweiss,
+// "One-out-of-Many Proofs: Or How to Leak a Secret and Spend a Coin", EUROCRYPT 2015) over
+// ristretto255, made non-interactive with Fiat-Shamir. The setup is transparent: Params are derived
+// from the list's Merkle tree alone, need no trusted setup and serve as both proving and verifying
+// key. Membership proofs are logarithmic in the size of the list; non-membership proofs add two
+// range proofs of fixed size. Proving and verifying are linear in the size of the list.
+//
+// The value committed to is the Merkle leaf hash of the address, truncated to 248 bits. Params hold
+// the Merkle root and the leaf hashes rather than the leaves, and are checked against the root when
+// derived or read, so a verifier trusting only the root can trust the params whose Root matches it.
+// Anyone holding the params can still test a candidate address against them, so they hide the list
+// only as far as its addresses cannot be guessed.
+//
+// A proof attests that its maker knows the opening of a Pedersen commitment C = v*G + r*H, and that
+// the hashed leaf v is one of the hashes in Params (Prove), or lies strictly between two adjacent
+// ones and so is none of them (ProveNonMembership). Proofs are bound to C and to a context chosen
+// by the caller, e.g. a nonce of the verifier, and do not verify for another commitment or context.
+// They say nothing about where C comes from: anyone can commit to a listed address and prove its
+// membership. A proof is therefore only meaningful for a commitment the verifier obtained from a
+// trusted source, e.g. issued along with a credential or registered before the list was published,
+// whose Opening only the party it is about holds.
+//
+// The proofs are implemented here on top of the ristretto255 group of circl rather than by an
+// audited proof system library, and have not had an independent cryptographic review. Have them
+// reviewed before relying on them.
+package zk
+
+import (
+	"addressdb/commitment"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"sort"
+
+	"github.com/cloudflare/circl/group"
+)
+
+var (
+	g = group.Ristretto255
+
+	dstGenerator = []byte("zkaddrstore-zk-v1-generator")
+	dstChallenge = []byte("zkaddrstore-zk-v3-challenge")
+
+	// h is the second Pedersen generator, whose discrete log relative to the group generator is unknown.
+	h = g.HashToElement([]byte("pedersen"), dstGenerator)
+)
+
+const (
+	maxBits     = 32  // Bounds the depth of proofs, i.e. lists hold fewer than 2^maxBits addresses.
+	valueBits   = 248 // Size of the hashed leaves; range proofs show differences of values fit in as many bits.
+	valueSize   = valueBits / 8
+	paramsMagic = "ZKPP"
+
+	membershipLabel    = "membership"
+	nonMembershipLabel = "non-membership"
+)
+
+var (
+	// ErrNotInSet is returned when proving the membership of a leaf that is not in the list.
+	ErrNotInSet = errors.New("leaf is not in the list")
+	// ErrInSet is returned when proving the non-membership of a leaf that is in the list.
+	ErrInSet = errors.New("leaf is in the list")
+)
+
+// Opening is the secret behind a commitment: the hashed leaf and the blinding factor. Whoever holds
+// it can prove statements about the committed leaf, so it must be kept private.
+type Opening struct {
+	value    []byte // Hashed leaf, big endian.
+	blinding group.Scalar
+}
+
+// Commit commits to leaf, the AddressHandler bytes of an address, with a random blinding factor.
+func Commit(leaf []byte) *Opening {
+	return &Opening{value: hashLeaf(leaf), blinding: g.RandomScalar(rand.Reader)}
+}
+
+// Commitment returns the encoded commitment, to publish or hand to verifiers.
+func (o *Opening) Commitment() ([]byte, error) {
+	return o.commitment().MarshalBinaryCompress()
+}
+
+func (o *Opening) commitment() group.Element {
+	return pedersen(scalar(o.value), o.blinding)
+}
+
+// MarshalBinary encodes the opening as the hashed leaf followed by the blinding factor.
+func (o *Opening) MarshalBinary() ([]byte, error) {
+	blinding, err := o.blinding.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, o.value...), blinding...), nil
+}
+
+// UnmarshalBinary decodes an opening encoded by MarshalBinary.
+func (o *Opening) UnmarshalBinary(data []byte) error {
+	if len(data) != valueSize+int(g.Params().ScalarLength) {
+		return errors.New("invalid opening length")
+	}
+	blinding := g.NewScalar()
+	if err := blinding.UnmarshalBinary(data[valueSize:]); err != nil {
+		return fmt.Errorf("invalid blinding factor: %w", err)
+	}
+	o.value, o.blinding = append([]byte{}, data[:valueSize]...), blinding
+	return nil
+}
+
+// Params holds the public parameters of proofs for one list: its Merkle root and the hashes of its
+// leaves.
+type Params struct {
+	root       []byte
+	leafHashes [][]byte // Merkle leaf hashes, in the order of the leaves.
+	hashes     [][]byte // Hashed leaves committed to, sorted and unique.
+	digest     []byte   // Hash of the root and the hashed leaves, binding proofs to them.
+	leaves     []group.Scalar
+	bits       int
+
+	// Gap i lies between the hashed leaves i-1 and i, from -1 below the first one to 2^valueBits
+	// above the last one. Like leaves, the gaps are padded to a power of two by repeating the last.
+	lower, upper []group.Scalar
+	gapBits      int
+}
+
+// Setup derives the parameters of proofs for the list committed to by tree.
+func Setup(tree *commitment.Tree) (*Params, error) {
+	leafHashes := make([][]byte, tree.Len())
+	for i := range leafHashes {
+		leafHashes[i] = tree.LeafHash(i)
+	}
+	return newParams(tree.Root(), leafHashes)
+}
+
+// newParams derives the parameters of the list with the given root from its Merkle leaf hashes,
+// checking that they hash up to the root.
+func newParams(root []byte, leafHashes [][]byte) (*Params, error) {
+	if len(leafHashes) == 0 {
+		return nil, errors.New("cannot set up proofs for an empty list")
+	}
+	if computed, err := commitment.RootOf(leafHashes); err != nil {
+		return nil, err
+	} else if !bytes.Equal(computed, root) {
+		return nil, errors.New("leaf hashes do not match the Merkle root")
+	}
+	n, gapBits := max(1, bits.Len(uint(len(leafHashes)-1))), max(1, bits.Len(uint(len(leafHashes))))
+	if gapBits > maxBits {
+		return nil, fmt.Errorf("list too large: %d addresses", len(leafHashes))
+	}
+
+	hashes := make([][]byte, len(leafHashes))
+	for i, leafHash := range leafHashes {
+		hashes[i] = leafHash[:valueSize]
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i], hashes[j]) < 0 })
+	for i := 1; i < len(hashes); i++ {
+		if bytes.Equal(hashes[i-1], hashes[i]) {
+			return nil, errors.New("two leaves of the list have the same hash")
+		}
+	}
+
+	digest := sha256.New()
+	digest.Write(root)
+	digest.Write(binary.BigEndian.AppendUint64(nil, uint64(len(hashes))))
+	for _, hash := range hashes {
+		digest.Write(hash)
+	}
+	p := &Params{root: root, leafHashes: leafHashes, hashes: hashes, digest: digest.Sum(nil), bits: n, gapBits: gapBits}
+
+	p.leaves = make([]group.Scalar, 1<<n)
+	for i := range p.leaves {
+		p.leaves[i] = scalar(hashes[min(i, len(hashes)-1)])
+	}
+	p.lower, p.upper = make([]group.Scalar, 1<<gapBits), make([]group.Scalar, 1<<gapBits)
+	for i := range p.lower {
+		switch j := min(i, len(hashes)); j {
+		case 0:
+			p.lower[i], p.upper[i] = g.NewScalar().Neg(g.NewScalar().SetUint64(1)), p.leaves[0]
+		case len(hashes):
+			p.lower[i], p.upper[i] = p.leaves[j-1], scalar(valueBound().Bytes())
+		default:
+			p.lower[i], p.upper[i] = p.leaves[j-1], p.leaves[j]
+		}
+	}
+	return p, nil
+}
+
+// Root returns the Merkle root of the list the parameters were derived from.
+func (p *Params) Root() []byte {
+	return p.root
+}
+
+// Len returns the number of addresses in the list.
+func (p *Params) Len() int {
+	return len(p.hashes)
+}
+
+// search returns the index of the hashed leaf value and whether it is in the list. If it is not,
+// the index is that of the gap holding it.
+func (p *Params) search(value []byte) (int, bool) {
+	i := sort.Search(len(p.hashes), func(i int) bool { return bytes.Compare(p.hashes[i], value) >= 0 })
+	return i, i < len(p.hashes) && bytes.Equal(p.hashes[i], value)
+}
+
+// gaps returns lower_i + y*upper_i for every gap i.
+func (p *Params) gaps(y group.Scalar) []group.Scalar {
+	values := make([]group.Scalar, len(p.lower))
+	for i := range values {
+		values[i] = g.NewScalar().Add(p.lower[i], g.NewScalar().Mul(y, p.upper[i]))
+	}
+	return values
+}
+
+// WriteTo writes the parameters to w: the Merkle root of the list and its leaf hashes, from which
+// ReadParams derives them again. The leaves themselves are not written.
+func (p *Params) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := append([]byte(paramsMagic), p.root...)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(p.leafHashes)))
+	n, err := bw.Write(header)
+	written := int64(n)
+	if err != nil {
+		return written, err
+	}
+	for _, hash := range p.leafHashes {
+		n, err := bw.Write(hash)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// ReadParams reads parameters written by WriteTo, checking that the leaf hashes match the root. The
+// caller must still check that Root is the root of the list it trusts.
+func ReadParams(r io.Reader) (*Params, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(paramsMagic)+commitment.HashSize+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read parameters header: %w", err)
+	}
+	if string(header[:len(paramsMagic)]) != paramsMagic {
+		return nil, errors.New("not a zero-knowledge parameters file")
+	}
+	root := header[len(paramsMagic) : len(paramsMagic)+commitment.HashSize]
+	count := binary.BigEndian.Uint64(header[len(paramsMagic)+commitment.HashSize:])
+	if count >= 1<<maxBits {
+		return nil, fmt.Errorf("list too large: %d addresses", count)
+	}
+
+	leafHashes := make([][]byte, 0, min(count, 1<<16))
+	for i := uint64(0); i < count; i++ {
+		hash := make([]byte, commitment.HashSize)
+		if _, err := io.ReadFull(br, hash); err != nil {
+			return nil, fmt.Errorf("failed to read leaf hash: %w", err)
+		}
+		leafHashes = append(leafHashes, hash)
+	}
+	return newParams(root, leafHashes)
+}
+
+// Proof proves that a commitment opens to one of the hashed leaves of a list.
+type Proof struct {
+	oneOfMany
+}
+
+// Prove proves that the leaf committed to by opening is in the list, for the given context.
+func Prove(params *Params, opening *Opening, context []byte) (*Proof, error) {
+	index, found := params.search(opening.value)
+	if !found {
+		return nil, ErrNotInSet
+	}
+
+	proof := &Proof{}
+	secrets := proof.commit(params.leaves, params.bits, index, opening.blinding)
+	t, err := newTranscript(membershipLabel, params, opening.commitment(), context)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.append(proof.elements()...); err != nil {
+		return nil, err
+	}
+	proof.respond(secrets, t.challenge())
+	return proof, nil
+}
+
+// Verify checks that proof proves commitment opens to a hashed leaf of the list of params, for the
+// given context.
+func Verify(params *Params, commitment, context []byte, proof *Proof) error {
+	c, err := decodeCommitment(commitment)
+	if err != nil {
+		return err
+	}
+	if !proof.valid(params.bits) {
+		return fmt.Errorf("proof is not for a list of %d addresses", params.Len())
+	}
+
+	t, err := newTranscript(membershipLabel, params, c, context)
+	if err != nil {
+		return err
+	}
+	if err := t.append(proof.elements()...); err != nil {
+		return err
+	}
+	if !proof.verify(params.leaves, c, t.challenge()) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+// NonMembershipProof proves that a commitment opens to a value v strictly between two adjacent
+// hashed leaves of a list, or below the first or above the last, and so to none of them. For the
+// gap (lo, hi) holding v, it proves that v-lo-1 and hi-v-1 fit in valueBits bits, which implies
+// lo < v < hi, and that (lo, hi) is a gap of the list without revealing which one.
+type NonMembershipProof struct {
+	lower, upper bitProof // Bits of v-lo-1 and of hi-v-1.
+	gap          oneOfMany
+}
+
+// ProveNonMembership proves that the leaf committed to by opening is not in the list, for the
+// given context.
+func ProveNonMembership(params *Params, opening *Opening, context []byte) (*NonMembershipProof, error) {
+	index, found := params.search(opening.value)
+	if found {
+		return nil, ErrInSet
+	}
+
+	one := big.NewInt(1)
+	v, lo, hi := new(big.Int).SetBytes(opening.value), big.NewInt(-1), valueBound()
+	if index > 0 {
+		lo.SetBytes(params.hashes[index-1])
+	}
+	if index < len(params.hashes) {
+		hi.SetBytes(params.hashes[index])
+	}
+	lowerBits := bitScalars(new(big.Int).Sub(new(big.Int).Sub(v, lo), one))
+	upperBits := bitScalars(new(big.Int).Sub(new(big.Int).Sub(hi, v), one))
+	lowerBlinding, upperBlinding := randomScalars(valueBits), randomScalars(valueBits)
+
+	proof := &NonMembershipProof{}
+	lowerSecrets := proof.lower.commit(lowerBits, lowerBlinding)
+	upperSecrets := proof.upper.commit(upperBits, upperBlinding)
+	t, err := newTranscript(nonMembershipLabel, params, opening.commitment(), context)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.append(append(proof.lower.elements(), proof.upper.elements()...)...); err != nil {
+		return nil, err
+	}
+	y := t.challenge()
+
+	// D_lo = C - G - sum 2^k lower.cl_k commits to lo and D_hi = C + G + sum 2^k upper.cl_k to hi,
+	// so D_lo + y*D_hi commits to the value of the gap, lo + y*hi, with this blinding factor.
+	blinding := g.NewScalar().Sub(opening.blinding, weightedScalars(lowerBlinding))
+	blindingHi := g.NewScalar().Add(opening.blinding, weightedScalars(upperBlinding))
+	blinding.Add(blinding, g.NewScalar().Mul(y, blindingHi))
+	gapSecrets := proof.gap.commit(params.gaps(y), params.gapBits, index, blinding)
+	if err := t.append(proof.gap.elements()...); err != nil {
+		return nil, err
+	}
+
+	x := t.challenge()
+	proof.lower.respond(lowerSecrets, x)
+	proof.upper.respond(upperSecrets, x)
+	proof.gap.respond(gapSecrets, x)
+	return proof, nil
+}
+
+// VerifyNonMembership checks that proof proves commitment opens to none of the hashed leaves of
+// the list of params, for the given context.
+func VerifyNonMembership(params *Params, commitment, context []byte, proof *NonMembershipProof) error {
+	c, err := decodeCommitment(commitment)
+	if err != nil {
+		return err
+	}
+	if !proof.lower.valid(valueBits) || !proof.upper.valid(valueBits) || !proof.gap.valid(params.gapBits) {
+		return fmt.Errorf("proof is not for a list of %d addresses", params.Len())
+	}
+
+	t, err := newTranscript(nonMembershipLabel, params, c, context)
+	if err != nil {
+		return err
+	}
+	if err := t.append(append(proof.lower.elements(), proof.upper.elements()...)...); err != nil {
+		return err
+	}
+	y := t.challenge()
+	if err := t.append(proof.gap.elements()...); err != nil {
+		return err
+	}
+	x := t.challenge()
+	if !proof.lower.verify(x) || !proof.upper.verify(x) {
+		return errors.New("invalid proof")
+	}
+
+	generator := g.NewElement().MulGen(g.NewScalar().SetUint64(1))
+	lower := g.NewElement().Neg(weightedElements(proof.lower.cl))
+	lower.Add(lower, c)
+	lower.Add(lower, g.NewElement().Neg(generator))
+	upper := weightedElements(proof.upper.cl)
+	upper.Add(upper, c)
+	upper.Add(upper, generator)
+	d := lower.Add(lower, g.NewElement().Mul(upper, y))
+	if !proof.gap.verify(params.gaps(y), d, x) {
+		return errors.New("invalid proof")
+	}
+	return nil
+}
+
+// bitProof proves that the commitments cl_j open to bits l_j. With ca_j = Com(a_j, s_j) and
+// cb_j = Com(l_j*a_j, t_j), the responses f_j = l_j*x + a_j satisfy x*cl_j + ca_j = Com(f_j, za_j)
+// and (x-f_j)*cl_j + cb_j = Com(0, zb_j) only if l_j*(1-l_j) = 0.
+type bitProof struct {
+	cl, ca, cb []group.Element
+	f, za, zb  []group.Scalar
+}
+
+// bitSecrets holds the values behind a bitProof until the challenge is known.
+type bitSecrets struct {
+	l, r, a, s, t []group.Scalar
+}
+
+// commit commits to the bits l with blinding factors r.
+func (p *bitProof) commit(l, r []group.Scalar) *bitSecrets {
+	n := len(l)
+	secrets := &bitSecrets{l: l, r: r, a: randomScalars(n), s: randomScalars(n), t: randomScalars(n)}
+	for j := 0; j < n; j++ {
+		p.cl = append(p.cl, pedersen(l[j], r[j]))
+		p.ca = append(p.ca, pedersen(secrets.a[j], secrets.s[j]))
+		p.cb = append(p.cb, pedersen(g.NewScalar().Mul(l[j], secrets.a[j]), secrets.t[j]))
+	}
+	return secrets
+}
+
+// respond completes the proof for the challenge x.
+func (p *bitProof) respond(secrets *bitSecrets, x group.Scalar) {
+	for j, l := range secrets.l {
+		f := g.NewScalar().Add(g.NewScalar().Mul(l, x), secrets.a[j])
+		za := g.NewScalar().Add(g.NewScalar().Mul(secrets.r[j], x), secrets.s[j])
+		zb := g.NewScalar().Add(g.NewScalar().Mul(secrets.r[j], g.NewScalar().Sub(x, f)), secrets.t[j])
+		p.f, p.za, p.zb = append(p.f, f), append(p.za, za), append(p.zb, zb)
+	}
+}
+
+// valid reports whether the proof is for n bits.
+func (p *bitProof) valid(n int) bool {
+	return len(p.cl) == n && len(p.ca) == n && len(p.cb) == n && len(p.f) == n && len(p.za) == n && len(p.zb) == n
+}
+
+// verify checks the proof for the challenge x.
+func (p *bitProof) verify(x group.Scalar) bool {
+	for j := range p.cl {
+		// x*cl_j + ca_j = Com(f_j, za_j)
+		left := g.NewElement().Mul(p.cl[j], x)
+		left.Add(left, p.ca[j])
+		if !left.IsEqual(pedersen(p.f[j], p.za[j])) {
+			return false
+		}
+		// (x-f_j)*cl_j + cb_j = Com(0, zb_j)
+		left = g.NewElement().Mul(p.cl[j], g.NewScalar().Sub(x, p.f[j]))
+		left.Add(left, p.cb[j])
+		if !left.IsEqual(g.NewElement().Mul(h, p.zb[j])) {
+			return false
+		}
+	}
+	return true
+}
+
+// elements returns the commitments of the proof, in transcript order.
+func (p *bitProof) elements() []group.Element {
+	return append(append(append([]group.Element{}, p.cl...), p.ca...), p.cb...)
+}
+
+// scalars returns the responses of the proof.
+func (p *bitProof) scalars() []group.Scalar {
+	return append(append(append([]group.Scalar{}, p.f...), p.za...), p.zb...)
+}
+
+// set sets the proof for n bits from its elements and scalars.
+func (p *bitProof) set(n int, elements []group.Element, scalars []group.Scalar) {
+	p.cl, p.ca, p.cb = elements[:n], elements[n:2*n], elements[2*n:3*n]
+	p.f, p.za, p.zb = scalars[:n], scalars[n:2*n], scalars[2*n:3*n]
+}
+
+// oneOfMany proves the knowledge of an index i and of r such that D - values[i]*G = r*H, for a
+// commitment D and 2^n public values, by proving the bits of i.
+type oneOfMany struct {
+	index bitProof
+	cd    []group.Element // Commitments to the coefficients of the polynomial, per degree.
+	zd    group.Scalar
+}
+
+// oneOfManySecrets holds the values behind a oneOfMany proof until the challenge is known.
+type oneOfManySecrets struct {
+	index    *bitSecrets
+	rho      []group.Scalar
+	blinding group.Scalar
+}
+
+// commit commits to index, the index of the value D commits to with the blinding factor r.
+func (p *oneOfMany) commit(values []group.Scalar, n, index int, r group.Scalar) *oneOfManySecrets {
+	l := make([]group.Scalar, n)
+	for j := range l {
+		l[j] = g.NewScalar().SetUint64(uint64(index>>j) & 1)
+	}
+	secrets := &oneOfManySecrets{index: p.index.commit(l, randomScalars(n)), rho: randomScalars(n), blinding: r}
+
+	// The commitments to zero of the statement are c_i = D - v_i*G, so that c_index = r*H. With
+	// p_i(x) = sum_k p_i,k x^k, cd_k = sum_i p_i,k c_i + rho_k*H. The sum of all p_i is x^n, so
+	// for k < n the D terms cancel out.
+	coefficients := proverCoefficients(values, l, secrets.index.a)
+	for k := 0; k < n; k++ {
+		cd := g.NewElement().MulGen(g.NewScalar().Neg(coefficients[k]))
+		p.cd = append(p.cd, cd.Add(cd, g.NewElement().Mul(h, secrets.rho[k])))
+	}
+	return secrets
+}
+
+// respond completes the proof for the challenge x.
+func (p *oneOfMany) respond(secrets *oneOfManySecrets, x group.Scalar) {
+	p.index.respond(secrets.index, x)
+
+	// zd = r*x^n - sum_k rho_k x^k
+	p.zd = g.NewScalar()
+	xk := g.NewScalar().SetUint64(1)
+	for _, rho := range secrets.rho {
+		p.zd.Sub(p.zd, g.NewScalar().Mul(rho, xk))
+		xk.Mul(xk, x)
+	}
+	p.zd.Add(p.zd, g.NewScalar().Mul(secrets.blinding, xk))
+}
+
+// valid reports whether the proof is for 2^n values.
+func (p *oneOfMany) valid(n int) bool {
+	return p.index.valid(n) && len(p.cd) == n && p.zd != nil
+}
+
+// verify checks that the proof proves d commits to one of values, for the challenge x.
+func (p *oneOfMany) verify(values []group.Scalar, d group.Element, x group.Scalar) bool {
+	if !p.index.verify(x) {
+		return false
+	}
+
+	// sum_i p_i(x) c_i - sum_k x^k cd_k = Com(0, zd), with sum_i p_i(x) c_i = x^n D - (sum_i p_i(x) v_i) G.
+	left := g.NewElement().Neg(g.NewElement().MulGen(verifierSum(values, x, p.index.f)))
+	xk := g.NewScalar().SetUint64(1)
+	for _, cd := range p.cd {
+		left.Add(left, g.NewElement().Neg(g.NewElement().Mul(cd, xk)))
+		xk.Mul(xk, x)
+	}
+	left.Add(left, g.NewElement().Mul(d, xk))
+	return left.IsEqual(g.NewElement().Mul(h, p.zd))
+}
+
+// elements returns the commitments of the proof, in transcript order.
+func (p *oneOfMany) elements() []group.Element {
+	return append(p.index.elements(), p.cd...)
+}
+
+// scalars returns the responses of the proof.
+func (p *oneOfMany) scalars() []group.Scalar {
+	return append(p.index.scalars(), p.zd)
+}
+
+// set sets the proof for 2^n values from its elements and scalars.
+func (p *oneOfMany) set(n int, elements []group.Element, scalars []group.Scalar) {
+	p.index.set(n, elements, scalars)
+	p.cd, p.zd = elements[3*n:4*n], scalars[3*n]
+}
+
+// proverCoefficients returns sum_i p_i,k v_i for k = 0..n, where p_i(x) = prod_j f_j,i_j(x) with
+// f_j,1(x) = l_j x + a_j and f_j,0(x) = (1-l_j) x - a_j.
+func proverCoefficients(values []group.Scalar, l, a []group.Scalar) []group.Scalar {
+	n := len(l)
+	one := g.NewScalar().SetUint64(1)
+	sums := make([]group.Scalar, n+1)
+	for k := range sums {
+		sums[k] = g.NewScalar()
+	}
+
+	// Depth-first over the bits of i, multiplying the polynomial by one factor per level.
+	var walk func(j, i int, poly []group.Scalar)
+	walk = func(j, i int, poly []group.Scalar) {
+		if j == n {
+			for k, c := range poly {
+				sums[k].Add(sums[k], g.NewScalar().Mul(c, values[i]))
+			}
+			return
+		}
+		oneMinusL := g.NewScalar().Sub(one, l[j])
+		walk(j+1, i, mulLinear(poly, oneMinusL, g.NewScalar().Neg(a[j])))
+		walk(j+1, i|1<<j, mulLinear(poly, l[j], a[j]))
+	}
+	walk(0, 0, []group.Scalar{one})
+	return sums
+}
+
+// mulLinear returns poly * (c1 x + c0).
+func mulLinear(poly []group.Scalar, c1, c0 group.Scalar) []group.Scalar {
+	result := make([]group.Scalar, len(poly)+1)
+	for k := range result {
+		result[k] = g.NewScalar()
+	}
+	for k, c := range poly {
+		result[k].Add(result[k], g.NewScalar().Mul(c, c0))
+		result[k+1].Add(result[k+1], g.NewScalar().Mul(c, c1))
+	}
+	return result
+}
+
+// verifierSum returns sum_i p_i(x) v_i, where p_i(x) = prod_j f_j,i_j with f_j,1 = f_j and f_j,0 = x - f_j.
+func verifierSum(values []group.Scalar, x group.Scalar, f []group.Scalar) group.Scalar {
+	n := len(f)
+	sum := g.NewScalar()
+	var walk func(j, i int, p group.Scalar)
+	walk = func(j, i int, p group.Scalar) {
+		if j == n {
+			sum.Add(sum, g.NewScalar().Mul(p, values[i]))
+			return
+		}
+		walk(j+1, i, g.NewScalar().Mul(p, g.NewScalar().Sub(x, f[j])))
+		walk(j+1, i|1<<j, g.NewScalar().Mul(p, f[j]))
+	}
+	walk(0, 0, g.NewScalar().SetUint64(1))
+	return sum
+}
+
+// transcript accumulates the statement and the commitments of a proof, from which the Fiat-Shamir
+// challenges are derived.
+type transcript []byte
+
+// newTranscript starts the transcript of a proof of the given kind about commitment c.
+func newTranscript(label string, params *Params, c group.Element, context []byte) (*transcript, error) {
+	t := &transcript{}
+	for _, data := range [][]byte{[]byte(label), params.digest, context} {
+		*t = binary.BigEndian.AppendUint32(*t, uint32(len(data)))
+		*t = append(*t, data...)
+	}
+	return t, t.append(c)
+}
+
+func (t *transcript) append(elements ...group.Element) error {
+	for _, element := range elements {
+		data, err := element.MarshalBinaryCompress()
+		if err != nil {
+			return err
+		}
+		*t = append(*t, data...)
+	}
+	return nil
+}
+
+// challenge derives a challenge from everything appended so far.
+func (t *transcript) challenge() group.Scalar {
+	return g.HashToScalar(*t, dstChallenge)
+}
+
+// pedersen returns the commitment v*G + r*H.
+func pedersen(v, r group.Scalar) group.Element {
+	c := g.NewElement().MulGen(v)
+	return c.Add(c, g.NewElement().Mul(h, r))
+}
+
+func decodeCommitment(data []byte) (group.Element, error) {
+	c := g.NewElement()
+	if err := c.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("invalid commitment: %w", err)
+	}
+	return c, nil
+}
+
+// hashLeaf returns the value committed to for leaf: its Merkle leaf hash, truncated to valueBits so
+// that differences between values fit in range proofs.
+func hashLeaf(leaf []byte) []byte {
+	return commitment.LeafHash(leaf)[:valueSize]
+}
+
+// valueBound returns 2^valueBits, above every hashed leaf.
+func valueBound() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), valueBits)
+}
+
+// scalar returns the big endian value, below the group order, as a scalar.
+func scalar(value []byte) group.Scalar {
+	padded := make([]byte, 32)
+	copy(padded[32-len(value):], value)
+	shift := g.NewScalar().SetUint64(1 << 32)
+	shift.Mul(shift, shift)
+	s := g.NewScalar()
+	for i := 0; i < len(padded); i += 8 {
+		s.Mul(s, shift)
+		s.Add(s, g.NewScalar().SetUint64(binary.BigEndian.Uint64(padded[i:])))
+	}
+	return s
+}
+
+// bitScalars returns the valueBits lowest bits of d, least significant first.
+func bitScalars(d *big.Int) []group.Scalar {
+	scalars := make([]group.Scalar, valueBits)
+	for k := range scalars {
+		scalars[k] = g.NewScalar().SetUint64(uint64(d.Bit(k)))
+	}
+	return scalars
+}
+
+// weightedScalars returns sum_k 2^k s_k.
+func weightedScalars(scalars []group.Scalar) group.Scalar {
+	sum := g.NewScalar()
+	for k := len(scalars) - 1; k >= 0; k-- {
+		sum.Add(sum, sum)
+		sum.Add(sum, scalars[k])
+	}
+	return sum
+}
+
+// weightedElements returns sum_k 2^k e_k.
+func weightedElements(elements []group.Element) group.Element {
+	sum := g.NewElement()
+	for k := len(elements) - 1; k >= 0; k-- {
+		sum.Add(sum, sum)
+		sum.Add(sum, elements[k])
+	}
+	return sum
+}
+
+func randomScalars(n int) []group.Scalar {
+	scalars := make([]group.Scalar, n)
+	for i := range scalars {
+		scalars[i] = g.RandomScalar(rand.Reader)
+	}
+	return scalars
+}
+
+// MarshalBinary encodes the proof as the number of bits of the index, the elements and then the scalars.
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	return marshal(len(p.cd), p.elements(), p.scalars())
+}
+
+// UnmarshalBinary decodes a proof encoded by MarshalBinary.
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	n, elements, scalars, err := unmarshal(data, func(n int) (int, int) { return 4 * n, 3*n + 1 })
+	if err != nil {
+		return err
+	}
+	p.set(n, elements, scalars)
+	return nil
+}
+
+// MarshalBinary encodes the proof as the number of bits of the gap index, the elements and then
+// the scalars.
+func (p *NonMembershipProof) MarshalBinary() ([]byte, error) {
+	elements := append(append(p.lower.elements(), p.upper.elements()...), p.gap.elements()...)
+	scalars := append(append(p.lower.scalars(), p.upper.scalars()...), p.gap.scalars()...)
+	return marshal(len(p.gap.cd), elements, scalars)
+}
+
+// UnmarshalBinary decodes a proof encoded by MarshalBinary.
+func (p *NonMembershipProof) UnmarshalBinary(data []byte) error {
+	n, elements, scalars, err := unmarshal(data, func(n int) (int, int) { return 6*valueBits + 4*n, 6*valueBits + 3*n + 1 })
+	if err != nil {
+		return err
+	}
+	p.lower.set(valueBits, elements, scalars)
+	p.upper.set(valueBits, elements[3*valueBits:], scalars[3*valueBits:])
+	p.gap.set(n, elements[6*valueBits:], scalars[6*valueBits:])
+	return nil
+}
+
+func marshal(n int, elements []group.Element, scalars []group.Scalar) ([]byte, error) {
+	data := []byte{byte(n)}
+	for _, element := range elements {
+		encoded, err := element.MarshalBinaryCompress()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	for _, scalar := range scalars {
+		encoded, err := scalar.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// unmarshal decodes the number of bits, elements and scalars encoded by marshal, with counts
+// returning the number of elements and scalars of a proof for n bits.
+func unmarshal(data []byte, counts func(n int) (int, int)) (int, []group.Element, []group.Scalar, error) {
+	if len(data) == 0 {
+		return 0, nil, nil, errors.New("empty proof")
+	}
+	n := int(data[0])
+	if n == 0 || n > maxBits {
+		return 0, nil, nil, fmt.Errorf("invalid proof size %d", n)
+	}
+	elementCount, scalarCount := counts(n)
+	elementLength, scalarLength := int(g.Params().CompressedElementLength), int(g.Params().ScalarLength)
+	if len(data) != 1+elementCount*elementLength+scalarCount*scalarLength {
+		return 0, nil, nil, errors.New("invalid proof length")
+	}
+	data = data[1:]
+
+	elements := make([]group.Element, elementCount)
+	for i := range elements {
+		elements[i] = g.NewElement()
+		if err := elements[i].UnmarshalBinary(data[:elementLength]); err != nil {
+			return 0, nil, nil, fmt.Errorf("invalid proof element: %w", err)
+		}
+		data = data[elementLength:]
+	}
+	scalars := make([]group.Scalar, scalarCount)
+	for i := range scalars {
+		scalars[i] = g.NewScalar()
+		if err := scalars[i].UnmarshalBinary(data[:scalarLength]); err != nil {
+			return 0, nil, nil, fmt.Errorf("invalid proof scalar: %w", err)
+		}
+		data = data[scalarLength:]
+	}
+	return n, elements, scalars, nil
+}
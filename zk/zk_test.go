@@ -0,0 +1,205 @@
+package zk
+
+import (
+	"addressdb/address"
+	"addressdb/commitment"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTree(t *testing.T, n int) (*commitment.Tree, [][]byte) {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = testLeaf(t, i+1)
+	}
+	return commitment.New(leaves), leaves
+}
+
+func testLeaf(t *testing.T, i int) []byte {
+	leaf, err := (&address.EVMAddressHandler{}).ToBytes(fmt.Sprintf("0x%040x", i))
+	require.NoError(t, err)
+	return leaf
+}
+
+func mustCommitment(t *testing.T, opening *Opening) []byte {
+	c, err := opening.Commitment()
+	require.NoError(t, err)
+	return c
+}
+
+func TestProveVerify(t *testing.T) {
+	context := []byte("nonce")
+	for _, n := range []int{1, 2, 3, 8, 13} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			tree, leaves := testTree(t, n)
+			params, err := Setup(tree)
+			require.NoError(t, err)
+
+			for _, leaf := range leaves {
+				opening := Commit(leaf)
+				c := mustCommitment(t, opening)
+				proof, err := Prove(params, opening, context)
+				require.NoError(t, err)
+				require.NoError(t, Verify(params, c, context, proof))
+
+				data, err := proof.MarshalBinary()
+				require.NoError(t, err)
+				var decoded Proof
+				require.NoError(t, decoded.UnmarshalBinary(data))
+				require.NoError(t, Verify(params, c, context, &decoded))
+
+				// The proof is bound to its commitment and context.
+				require.Error(t, Verify(params, mustCommitment(t, Commit(leaf)), context, proof))
+				require.Error(t, Verify(params, c, []byte("other nonce"), proof))
+			}
+		})
+	}
+}
+
+func TestProveVerifyNonMembership(t *testing.T) {
+	context := []byte("nonce")
+	for _, n := range []int{1, 2, 5} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			tree, leaves := testTree(t, n)
+			params, err := Setup(tree)
+			require.NoError(t, err)
+
+			// Prove a value in every gap, including below the first and above the last hashed
+			// leaf, right next to one of its bounds.
+			for gap := 0; gap <= n; gap++ {
+				value := new(big.Int).Sub(valueBound(), big.NewInt(1))
+				if gap < n {
+					value.SetBytes(params.hashes[gap])
+					value.Sub(value, big.NewInt(1))
+				}
+				if gap > 0 && gap%2 == 0 {
+					value.SetBytes(params.hashes[gap-1])
+					value.Add(value, big.NewInt(1))
+				}
+				opening := &Opening{value: value.FillBytes(make([]byte, valueSize)), blinding: g.RandomScalar(rand.Reader)}
+				c := mustCommitment(t, opening)
+				proof, err := ProveNonMembership(params, opening, context)
+				require.NoError(t, err)
+				require.NoError(t, VerifyNonMembership(params, c, context, proof), "gap %d", gap)
+				if gap > 0 {
+					continue
+				}
+
+				data, err := proof.MarshalBinary()
+				require.NoError(t, err)
+				var decoded NonMembershipProof
+				require.NoError(t, decoded.UnmarshalBinary(data))
+				require.NoError(t, VerifyNonMembership(params, c, context, &decoded))
+
+				// The proof is bound to its commitment and context.
+				require.Error(t, VerifyNonMembership(params, mustCommitment(t, Commit(leaves[0])), context, proof))
+				require.Error(t, VerifyNonMembership(params, c, []byte("other nonce"), proof))
+			}
+
+			_, err = ProveNonMembership(params, Commit(leaves[0]), context)
+			require.ErrorIs(t, err, ErrInSet)
+		})
+	}
+}
+
+func TestProveRejectsAbsentLeaf(t *testing.T) {
+	tree, _ := testTree(t, 4)
+	params, err := Setup(tree)
+	require.NoError(t, err)
+
+	_, err = Prove(params, Commit(bytes.Repeat([]byte{0xff}, 20)), nil)
+	require.ErrorIs(t, err, ErrNotInSet)
+
+	_, err = Setup(commitment.New(nil))
+	require.Error(t, err)
+}
+
+func TestVerifyRejectsInvalidProofs(t *testing.T) {
+	tree, leaves := testTree(t, 8)
+	params, err := Setup(tree)
+	require.NoError(t, err)
+	opening := Commit(leaves[5])
+	c := mustCommitment(t, opening)
+	proof, err := Prove(params, opening, nil)
+	require.NoError(t, err)
+
+	// A proof is bound to the list it was made for.
+	otherTree, _ := testTree(t, 7)
+	otherParams, err := Setup(otherTree)
+	require.NoError(t, err)
+	require.Error(t, Verify(otherParams, c, nil, proof))
+
+	// Changing any part of the proof invalidates it.
+	data, err := proof.MarshalBinary()
+	require.NoError(t, err)
+	for _, offset := range []int{1, 40, len(data) / 2, len(data) - 5} {
+		tampered := append([]byte{}, data...)
+		tampered[offset] ^= 1
+		var decoded Proof
+		if decoded.UnmarshalBinary(tampered) == nil {
+			require.Error(t, Verify(params, c, nil, &decoded), "offset %d", offset)
+		}
+	}
+	var decoded Proof
+	require.Error(t, decoded.UnmarshalBinary(data[:len(data)-1]))
+
+	// The same holds for non-membership proofs.
+	absent := Commit(testLeaf(t, 100))
+	absentCommitment := mustCommitment(t, absent)
+	nonMembership, err := ProveNonMembership(params, absent, nil)
+	require.NoError(t, err)
+	require.Error(t, VerifyNonMembership(otherParams, absentCommitment, nil, nonMembership))
+	data, err = nonMembership.MarshalBinary()
+	require.NoError(t, err)
+	for _, offset := range []int{1, 40, len(data) / 2, len(data) - 5} {
+		tampered := append([]byte{}, data...)
+		tampered[offset] ^= 1
+		var decoded NonMembershipProof
+		if decoded.UnmarshalBinary(tampered) == nil {
+			require.Error(t, VerifyNonMembership(params, absentCommitment, nil, &decoded), "offset %d", offset)
+		}
+	}
+}
+
+func TestParamsWriteRead(t *testing.T) {
+	tree, leaves := testTree(t, 5)
+	params, err := Setup(tree)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = params.WriteTo(&buf)
+	require.NoError(t, err)
+	for _, leaf := range leaves {
+		require.False(t, bytes.Contains(buf.Bytes(), leaf), "Parameters must not contain the leaves")
+	}
+	data := append([]byte{}, buf.Bytes()...)
+	read, err := ReadParams(&buf)
+	require.NoError(t, err)
+	require.Equal(t, params.Root(), read.Root())
+
+	// Parameters whose leaf hashes do not match their root are rejected.
+	data[len(data)-1] ^= 1
+	_, err = ReadParams(bytes.NewReader(data))
+	require.Error(t, err)
+	require.Equal(t, params.Len(), read.Len())
+
+	opening := Commit(leaves[0])
+	proof, err := Prove(params, opening, nil)
+	require.NoError(t, err)
+	require.NoError(t, Verify(read, mustCommitment(t, opening), nil, proof))
+}
+
+func TestOpeningMarshal(t *testing.T) {
+	opening := Commit(testLeaf(t, 1))
+	data, err := opening.MarshalBinary()
+	require.NoError(t, err)
+	var decoded Opening
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	require.Equal(t, mustCommitment(t, opening), mustCommitment(t, &decoded))
+	require.Error(t, decoded.UnmarshalBinary(data[1:]))
+}